@@ -0,0 +1,268 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// CacheConfig set how long the responses of the read endpoints are cached.
+// A zero TTL disables the cache of the endpoint
+type CacheConfig struct {
+	ProjectInfoTTL time.Duration
+	RegionsTTL     time.Duration
+	TunnelsTTL     time.Duration
+	// StaleTTL keep an expired response for this long after its TTL. It's returned
+	// at once while being refreshed in background, and keep being returned if the
+	// refresh fails, so that a hiccup of the api server does not break the callers
+	StaleTTL time.Duration
+}
+
+// DefaultCacheConfig cache project infos and tunnels for 30 seconds, regions for 10 minutes,
+// and serve them for 5 more minutes if the api server fails
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{
+		ProjectInfoTTL: 30 * time.Second,
+		RegionsTTL:     10 * time.Minute,
+		TunnelsTTL:     30 * time.Second,
+		StaleTTL:       5 * time.Minute,
+	}
+}
+
+// CachedWorker decorate a Worker with a TTL cache of GetProjectInfo, GetRegions and GetTunnels.
+// The cached values are shared by the callers and must not be modified
+type CachedWorker struct {
+	worker Worker
+	config CacheConfig
+	cache  *cache.Cache
+
+	lock sync.Mutex
+	// the keys being refreshed in background
+	refreshing map[string]bool
+	// bumped by Invalidate and Flush, a fetch started before drop its result
+	generations map[string]uint64
+	flushes     uint64
+}
+
+type cacheEntry struct {
+	value     interface{}
+	fetchedAt time.Time
+}
+
+// NewCachedWorker returns w with the cache
+func NewCachedWorker(w Worker, config CacheConfig) *CachedWorker {
+	return &CachedWorker{
+		worker:      w,
+		config:      config,
+		cache:       cache.New(cache.NoExpiration, time.Minute),
+		refreshing:  make(map[string]bool),
+		generations: make(map[string]uint64),
+	}
+}
+
+// Invalidate drop the cached info and tunnels of the project
+func (c *CachedWorker) Invalidate(projectID string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, key := range []string{projectInfoKey(projectID), tunnelsKey(projectID)} {
+		c.generations[key]++
+		c.cache.Delete(key)
+	}
+}
+
+// Flush drop all cached responses
+func (c *CachedWorker) Flush() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.flushes++
+	c.cache.Flush()
+}
+
+// generation returns the generation of key, it changes when the key is invalidated or flushed
+func (c *CachedWorker) generation(key string) uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.flushes + c.generations[key]
+}
+
+// set cache the value fetched at generation gen, unless the key was invalidated since
+func (c *CachedWorker) set(key string, gen uint64, value interface{}, ttl time.Duration) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.flushes+c.generations[key] != gen {
+		return false
+	}
+
+	c.cache.Set(key, &cacheEntry{value: value, fetchedAt: time.Now()}, ttl+c.config.StaleTTL)
+	return true
+}
+
+func (c *CachedWorker) UpldateProject(req *ReqUpdatePorjct) error {
+	return c.UpldateProjectCtx(context.Background(), req)
+}
+
+func (c *CachedWorker) UpldateProjectCtx(ctx context.Context, req *ReqUpdatePorjct) error {
+	defer c.Invalidate(req.ID)
+	return c.worker.UpldateProjectCtx(ctx, req)
+}
+
+// CreateProject is not cached, no cached response refers to a project not yet created
+func (c *CachedWorker) CreateProject(req *ReqCreateProject) error {
+	return c.CreateProjectCtx(context.Background(), req)
+}
+
+func (c *CachedWorker) CreateProjectCtx(ctx context.Context, req *ReqCreateProject) error {
+	return c.worker.CreateProjectCtx(ctx, req)
+}
+
+func (c *CachedWorker) GetProjects(page, size int) ([]*Project, error) {
+	return c.GetProjectsCtx(context.Background(), page, size)
+}
+
+// GetProjectsCtx is not cached, it's how the callers find the created and deleted projects
+func (c *CachedWorker) GetProjectsCtx(ctx context.Context, page, size int) ([]*Project, error) {
+	return c.worker.GetProjectsCtx(ctx, page, size)
+}
+
+func (c *CachedWorker) DeleteProject(projectID string) error {
+	return c.DeleteProjectCtx(context.Background(), projectID)
+}
+
+func (c *CachedWorker) DeleteProjectCtx(ctx context.Context, projectID string) error {
+	defer c.Invalidate(projectID)
+	return c.worker.DeleteProjectCtx(ctx, projectID)
+}
+
+func (c *CachedWorker) GetProjectInfo(projectID string) (*PorjectInfo, error) {
+	return c.GetProjectInfoCtx(context.Background(), projectID)
+}
+
+func (c *CachedWorker) GetProjectInfoCtx(ctx context.Context, projectID string) (*PorjectInfo, error) {
+	return cached(ctx, c, projectInfoKey(projectID), c.config.ProjectInfoTTL, func(ctx context.Context) (*PorjectInfo, error) {
+		return c.worker.GetProjectInfoCtx(ctx, projectID)
+	})
+}
+
+func (c *CachedWorker) GetRegions(area string) (*AreaList, error) {
+	return c.GetRegionsCtx(context.Background(), area)
+}
+
+func (c *CachedWorker) GetRegionsCtx(ctx context.Context, area string) (*AreaList, error) {
+	return cached(ctx, c, "regions/"+area, c.config.RegionsTTL, func(ctx context.Context) (*AreaList, error) {
+		return c.worker.GetRegionsCtx(ctx, area)
+	})
+}
+
+func (c *CachedWorker) ListNodesWithRegions(areaID string, region string, page, size int) (*RegionNodeList, error) {
+	return c.ListNodesWithRegionsCtx(context.Background(), areaID, region, page, size)
+}
+
+func (c *CachedWorker) ListNodesWithRegionsCtx(ctx context.Context, areaID string, region string, page, size int) (*RegionNodeList, error) {
+	return c.worker.ListNodesWithRegionsCtx(ctx, areaID, region, page, size)
+}
+
+func (c *CachedWorker) GetTunnels(projectID string) ([]*Tunnel, error) {
+	return c.GetTunnelsCtx(context.Background(), projectID)
+}
+
+func (c *CachedWorker) GetTunnelsCtx(ctx context.Context, projectID string) ([]*Tunnel, error) {
+	return cached(ctx, c, tunnelsKey(projectID), c.config.TunnelsTTL, func(ctx context.Context) ([]*Tunnel, error) {
+		return c.worker.GetTunnelsCtx(ctx, projectID)
+	})
+}
+
+func (c *CachedWorker) LoadProjects(page, size int) ([]*PorjectInfo, error) {
+	return c.LoadProjectsCtx(context.Background(), page, size)
+}
+
+// LoadProjectsCtx get the project list from the api server, and the infos from the cache
+func (c *CachedWorker) LoadProjectsCtx(ctx context.Context, page, size int) ([]*PorjectInfo, error) {
+	projects, err := c.GetProjectsCtx(ctx, page, size)
+	var accountErrs AccountErrors
+	if err != nil && !errors.As(err, &accountErrs) {
+		return nil, err
+	}
+
+	pInfos := make([]*PorjectInfo, 0)
+	err = loadProjectInfos(ctx, c, projects, concurrencyOf(c.worker), func(pInfo *PorjectInfo) error {
+		pInfos = append(pInfos, pInfo)
+		return nil
+	})
+
+	var projectErrs ProjectErrors
+	if err != nil && !errors.As(err, &projectErrs) {
+		return nil, err
+	}
+	return pInfos, partialErrors(accountErrs, projectErrs)
+}
+
+// cached returns the fresh cached value of key, or fetch it.
+// A stale value is returned at once and refreshed in background
+func cached[T any](ctx context.Context, c *CachedWorker, key string, ttl time.Duration, fetch func(ctx context.Context) (T, error)) (T, error) {
+	if ttl <= 0 {
+		return fetch(ctx)
+	}
+
+	if v, ok := c.cache.Get(key); ok {
+		entry := v.(*cacheEntry)
+		if time.Since(entry.fetchedAt) >= ttl {
+			c.refreshInBackground(key, ttl, func(ctx context.Context) (interface{}, error) {
+				return fetch(ctx)
+			})
+		}
+		return entry.value.(T), nil
+	}
+
+	gen := c.generation(key)
+	value, err := fetch(ctx)
+	if err != nil {
+		return value, err
+	}
+
+	c.set(key, gen, value, ttl)
+	return value, nil
+}
+
+func (c *CachedWorker) refreshInBackground(key string, ttl time.Duration, fetch func(ctx context.Context) (interface{}, error)) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.refreshing[key] {
+		return
+	}
+	c.refreshing[key] = true
+	gen := c.flushes + c.generations[key]
+
+	go func() {
+		defer func() {
+			c.lock.Lock()
+			delete(c.refreshing, key)
+			c.lock.Unlock()
+		}()
+
+		value, err := fetch(context.Background())
+		if err != nil {
+			log.Warnf("refresh %s failed, keep the stale value: %s", key, err.Error())
+			return
+		}
+
+		if !c.set(key, gen, value, ttl) {
+			log.Infof("refresh %s dropped, the key was invalidated", key)
+		}
+	}()
+}
+
+func projectInfoKey(projectID string) string {
+	return "info/" + projectID
+}
+
+func tunnelsKey(projectID string) string {
+	return "tunnels/" + projectID
+}
@@ -0,0 +1,131 @@
+package worker_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	worker "github.com/zscboy/titan-workers-sdk"
+	"github.com/zscboy/titan-workers-sdk/workertest"
+)
+
+const infoPath = "/api/v1/project/info"
+
+func TestCachedWorker(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	w := worker.NewCachedWorker(newTestWorker(t, s), worker.DefaultCacheConfig())
+	id := addProject(s, "cached", 1)
+
+	for i := 0; i < 3; i++ {
+		if _, err := w.GetProjectInfo(id); err != nil {
+			t.Fatalf("GetProjectInfo %s", err.Error())
+		}
+	}
+
+	if calls := s.Calls(infoPath); calls != 1 {
+		t.Fatalf("info calls %d, expect 1", calls)
+	}
+
+	req := &worker.ReqUpdatePorjct{ID: id, ProjectBase: worker.ProjectBase{Name: "renamed"}}
+	if err := w.UpldateProject(req); err != nil {
+		t.Fatalf("UpldateProject %s", err.Error())
+	}
+
+	info, err := w.GetProjectInfo(id)
+	if err != nil || info.Name != "renamed" {
+		t.Fatalf("GetProjectInfo after update returns %#v, %v", info, err)
+	}
+}
+
+func TestCachedWorkerServeStale(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	config := worker.CacheConfig{ProjectInfoTTL: 10 * time.Millisecond, StaleTTL: time.Minute}
+	w := worker.NewCachedWorker(newTestWorker(t, s, worker.WithRetryPolicy(worker.NoRetry())), config)
+	id := addProject(s, "stale", 1)
+
+	if _, err := w.GetProjectInfo(id); err != nil {
+		t.Fatalf("GetProjectInfo %s", err.Error())
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	s.InjectFault(infoPath, 1, workertest.Fault{StatusCode: http.StatusInternalServerError})
+
+	info, err := w.GetProjectInfo(id)
+	if err != nil || info.ID != id {
+		t.Fatalf("stale GetProjectInfo returns %#v, %v", info, err)
+	}
+
+	// the failed background refresh keeps the stale value
+	deadline := time.Now().Add(time.Second)
+	for s.Calls(infoPath) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := w.GetProjectInfo(id); err != nil {
+		t.Fatalf("GetProjectInfo after failed refresh %s", err.Error())
+	}
+}
+
+// blockingWorker hold the nth GetProjectInfo until release is closed
+type blockingWorker struct {
+	worker.Worker
+	block   int
+	calls   int
+	started chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingWorker) GetProjectInfoCtx(ctx context.Context, projectID string) (*worker.PorjectInfo, error) {
+	w.calls++
+	info, err := w.Worker.GetProjectInfoCtx(ctx, projectID)
+	if w.calls == w.block {
+		close(w.started)
+		<-w.release
+	}
+	return info, err
+}
+
+func TestCachedWorkerRefreshAfterInvalidate(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	bw := &blockingWorker{Worker: newTestWorker(t, s), block: 2, started: make(chan struct{}), release: make(chan struct{})}
+	config := worker.CacheConfig{ProjectInfoTTL: 20 * time.Millisecond, StaleTTL: time.Minute}
+	w := worker.NewCachedWorker(bw, config)
+	id := addProject(s, "old", 1)
+
+	if _, err := w.GetProjectInfo(id); err != nil {
+		t.Fatalf("GetProjectInfo %s", err.Error())
+	}
+
+	// the stale value starts a refresh, which fetch the old name and hold it
+	time.Sleep(30 * time.Millisecond)
+	if _, err := w.GetProjectInfo(id); err != nil {
+		t.Fatalf("stale GetProjectInfo %s", err.Error())
+	}
+	<-bw.started
+
+	req := &worker.ReqUpdatePorjct{ID: id, ProjectBase: worker.ProjectBase{Name: "new"}}
+	if err := w.UpldateProject(req); err != nil {
+		t.Fatalf("UpldateProject %s", err.Error())
+	}
+
+	info, err := w.GetProjectInfo(id)
+	if err != nil || info.Name != "new" {
+		t.Fatalf("GetProjectInfo after update returns %#v, %v", info, err)
+	}
+
+	// the refresh started before the update must not write the old name back
+	close(bw.release)
+	time.Sleep(50 * time.Millisecond)
+
+	info, err = w.GetProjectInfo(id)
+	if err != nil || info.Name != "new" {
+		t.Fatalf("GetProjectInfo after the stale refresh returns %#v, %v", info, err)
+	}
+}
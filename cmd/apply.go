@@ -0,0 +1,430 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	worker "github.com/zscboy/titan-workers-sdk"
+	"github.com/zscboy/titan-workers-sdk/config"
+	"github.com/zscboy/titan-workers-sdk/tablewriter"
+)
+
+const (
+	actionCreate = "create"
+	actionUpdate = "update"
+	actionDelete = "delete"
+	// actionReplace delete the project and create it again, for the changes of immutable fields
+	actionReplace = "replace"
+
+	// expirationTolerance is the difference of expiration ignored by apply,
+	// e.g. the clock skew between the client and the api server
+	expirationTolerance = 10 * time.Minute
+)
+
+var applyCmd = &cobra.Command{
+	Use:     "apply",
+	Short:   "create, update or delete projects to match a projects file",
+	Example: "apply -f /path/to/projects.toml /path/to/config",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apply(cmd, args); err != nil {
+			fmt.Println("apply ", err.Error())
+		}
+	},
+}
+
+// applyAction is a change of the plan
+type applyAction struct {
+	action    string
+	name      string
+	projectID string
+	changes   string
+
+	create *worker.ReqCreateProject
+	update *worker.ReqUpdatePorjct
+}
+
+// applyOptions control planApply
+type applyOptions struct {
+	// prune delete the deployed projects which are not in the projects file
+	prune bool
+	// recreate replace the projects whose immutable fields changed, the plan fails otherwise
+	recreate bool
+	// partial means some accounts failed to list their projects, the projects
+	// not found may be deployed in them, so they are not created
+	partial bool
+}
+
+func apply(cmd *cobra.Command, args []string) error {
+	projectsFilePath, err := cmd.Flags().GetString("file")
+	if len(projectsFilePath) == 0 || err != nil {
+		return fmt.Errorf("Must set --file")
+	}
+
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+
+	prune, err := cmd.Flags().GetBool("prune")
+	if err != nil {
+		return err
+	}
+
+	recreate, err := cmd.Flags().GetBool("recreate")
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return fmt.Errorf("Please specify the name of the config file")
+	}
+
+	configFilePath := args[0]
+	if _, err := os.Stat(configFilePath); os.IsNotExist(err) {
+		return fmt.Errorf("%s does not exist.", configFilePath)
+	}
+
+	cfg, err := config.ParseConfig(configFilePath)
+	if err != nil {
+		return fmt.Errorf("parse config error " + err.Error())
+	}
+
+	desired, err := config.ParseProjects(projectsFilePath)
+	if err != nil {
+		return fmt.Errorf("parse projects error " + err.Error())
+	}
+
+	w, err := newWorker(cfg)
+	if err != nil {
+		return fmt.Errorf("NewWorker %s", err.Error())
+	}
+
+	projects, err := worker.NewProjectIterator(w, 50).All(context.Background())
+	partial := worker.IsPartial(err)
+	if partial {
+		log.Warnf("list projects: %s", err.Error())
+	} else if err != nil {
+		return err
+	}
+
+	nodes, err := loadSpecNodeIDs(w, projects, desired)
+	if err != nil {
+		return err
+	}
+
+	actions, err := planApply(projects, nodes, desired, applyOptions{prune: prune, recreate: recreate, partial: partial})
+	if err != nil {
+		return err
+	}
+
+	if len(actions) == 0 {
+		fmt.Println("projects are up to date")
+		return nil
+	}
+
+	printApplyPlan(actions)
+	if dryRun {
+		return nil
+	}
+
+	failed := 0
+	for _, action := range actions {
+		if err := applyOne(w, action); err != nil {
+			fmt.Printf("%s %s failed: %s\n", action.action, action.name, err.Error())
+			failed++
+			continue
+		}
+		fmt.Printf("%s %s success\n", action.action, action.name)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d changes failed", failed, len(actions))
+	}
+	return nil
+}
+
+// loadSpecNodeIDs returns the node ids of the deployed projects by project id,
+// only for the projects whose spec set node_ids
+func loadSpecNodeIDs(w worker.Worker, projects []*worker.Project, desired *config.Projects) (map[string][]string, error) {
+	specs := make(map[string]bool)
+	for _, spec := range desired.Projects {
+		if len(spec.NodeIDs) > 0 {
+			specs[spec.Name] = true
+		}
+	}
+
+	nodes := make(map[string][]string)
+	for _, project := range projects {
+		if !specs[project.Name] {
+			continue
+		}
+
+		info, err := w.GetProjectInfo(project.ID)
+		if err != nil {
+			return nil, fmt.Errorf("get project %s info failed %s", project.ID, err.Error())
+		}
+
+		ids := make([]string, 0, len(info.Nodes))
+		for _, node := range info.Nodes {
+			ids = append(ids, node.ID)
+		}
+		nodes[project.ID] = ids
+	}
+	return nodes, nil
+}
+
+// planApply returns the changes to make the deployed projects match the desired projects.
+// Projects are matched by name, the deployed projects not in desired are deleted only if prune,
+// each one of them if several share a name. A name of desired shared by several deployed
+// projects can not be matched, planApply returns an error.
+// Every field set in desired is compared, nodes are the node ids of the deployed projects
+// by project id, they are needed for the projects whose spec set node_ids.
+// The projects whose area_id, region, node_ids or version changed are replaced if recreate,
+// otherwise planApply returns an error
+func planApply(projects []*worker.Project, nodes map[string][]string, desired *config.Projects, opts applyOptions) ([]*applyAction, error) {
+	// deploy to several regions create projects of the same name
+	deployed := make(map[string]*worker.Project)
+	duplicates := make(map[string]bool)
+	for _, project := range projects {
+		if _, ok := deployed[project.Name]; ok {
+			duplicates[project.Name] = true
+		}
+		deployed[project.Name] = project
+	}
+
+	for _, spec := range desired.Projects {
+		if duplicates[spec.Name] {
+			return nil, fmt.Errorf("more than one project named %s, can not match it", spec.Name)
+		}
+	}
+
+	now := time.Now()
+	actions := make([]*applyAction, 0)
+	names := make(map[string]bool)
+	drifts := make([]string, 0)
+	for _, spec := range desired.Projects {
+		names[spec.Name] = true
+
+		project, ok := deployed[spec.Name]
+		if !ok && opts.partial {
+			log.Warnf("project %s is not found, it may be deployed in a failed account, skip creating it", spec.Name)
+			continue
+		}
+
+		if !ok {
+			req, err := toCreateProject(spec)
+			if err != nil {
+				return nil, err
+			}
+			changes := fmt.Sprintf("bundle_url=%s replicas=%d area_id=%s region=%s", spec.BundleURL, spec.Replicas, spec.AreaID, spec.Region)
+			actions = append(actions, &applyAction{action: actionCreate, name: spec.Name, changes: changes, create: req})
+			continue
+		}
+
+		immutable, err := immutableChanges(project, nodes, spec)
+		if err != nil {
+			return nil, err
+		}
+
+		changes := make([]string, 0)
+		if project.BundleURL != spec.BundleURL {
+			changes = append(changes, fmt.Sprintf("bundle_url: %s -> %s", project.BundleURL, spec.BundleURL))
+		}
+		if project.Replicas != spec.Replicas {
+			changes = append(changes, fmt.Sprintf("replicas: %d -> %d", project.Replicas, spec.Replicas))
+		}
+
+		expiration, err := expirationChange(project, spec, now)
+		if err != nil {
+			return nil, err
+		}
+		if len(expiration) > 0 {
+			changes = append(changes, fmt.Sprintf("expiration: %s -> %s", project.Expiration, expiration))
+		}
+
+		// the immutable fields can not be updated, the project need to be deleted and created again
+		if len(immutable) > 0 {
+			if !opts.recreate {
+				drifts = append(drifts, fmt.Sprintf("%s (%s)", spec.Name, strings.Join(immutable, ", ")))
+				continue
+			}
+
+			req, err := toCreateProject(spec)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(immutable, changes...)
+			actions = append(actions, &applyAction{action: actionReplace, name: spec.Name, projectID: project.ID, changes: strings.Join(changes, ", "), create: req})
+			continue
+		}
+
+		if len(changes) == 0 {
+			continue
+		}
+
+		base := worker.ProjectBase{Name: spec.Name, BundleURL: spec.BundleURL, Replicas: spec.Replicas}
+		req := &worker.ReqUpdatePorjct{ID: project.ID, ProjectBase: base, Expiration: expiration}
+		actions = append(actions, &applyAction{action: actionUpdate, name: spec.Name, projectID: project.ID, changes: strings.Join(changes, ", "), update: req})
+	}
+
+	if len(drifts) > 0 {
+		return nil, fmt.Errorf("immutable fields changed: %s, apply with --recreate to delete and create them again", strings.Join(drifts, "; "))
+	}
+
+	if !opts.prune {
+		return actions, nil
+	}
+
+	for _, project := range projects {
+		if !names[project.Name] {
+			actions = append(actions, &applyAction{action: actionDelete, name: project.Name, projectID: project.ID})
+		}
+	}
+	return actions, nil
+}
+
+// immutableChanges returns the changes of the fields which can not be updated
+func immutableChanges(project *worker.Project, nodes map[string][]string, spec config.Project) ([]string, error) {
+	changes := make([]string, 0)
+	if project.AreaID != spec.AreaID {
+		changes = append(changes, fmt.Sprintf("area_id: %s -> %s", project.AreaID, spec.AreaID))
+	}
+	if project.Region != spec.Region {
+		changes = append(changes, fmt.Sprintf("region: %s -> %s", project.Region, spec.Region))
+	}
+
+	if len(spec.NodeIDs) > 0 {
+		deployedNodes, ok := nodes[project.ID]
+		if !ok {
+			return nil, fmt.Errorf("node ids of project %s are not loaded", project.ID)
+		}
+
+		current, desired := strings.Join(sortedIDs(deployedNodes), ","), strings.Join(sortedIDs(strings.Split(spec.NodeIDs, ",")), ",")
+		if current != desired {
+			changes = append(changes, fmt.Sprintf("node_ids: %s -> %s", current, desired))
+		}
+	}
+
+	if len(spec.Version) > 0 {
+		ver, err := worker.ParseVersion(spec.Version)
+		if err != nil {
+			return nil, fmt.Errorf("project %s %s", spec.Name, err.Error())
+		}
+		if ver != project.Version {
+			changes = append(changes, fmt.Sprintf("version: %s -> %s", project.Version, ver))
+		}
+	}
+	return changes, nil
+}
+
+// expirationChange returns the expiration to update the project to, empty if it matches the spec.
+// A duration like "30d" is counted from the creation of the project, so it matches until renewed
+func expirationChange(project *worker.Project, spec config.Project, now time.Time) (string, error) {
+	if len(spec.Expiration) == 0 {
+		return "", nil
+	}
+
+	base := now
+	if _, err := worker.ParseDuration(spec.Expiration); err == nil {
+		createTime, err := project.CreateTime()
+		if err != nil {
+			return "", fmt.Errorf("project %s expiration %s can not be compared: %s", spec.Name, spec.Expiration, err.Error())
+		}
+		base = createTime
+	}
+
+	want, err := worker.ParseExpiration(spec.Expiration, base)
+	if err != nil {
+		return "", fmt.Errorf("project %s %s", spec.Name, err.Error())
+	}
+
+	if current, err := project.ExpireTime(); err == nil {
+		diff := want.Sub(current)
+		if diff < expirationTolerance && diff > -expirationTolerance {
+			return "", nil
+		}
+	}
+
+	if !want.After(now) {
+		return "", fmt.Errorf("project %s expiration %s is in the past", spec.Name, worker.FormatExpiration(want))
+	}
+	return worker.FormatExpiration(want), nil
+}
+
+// sortedIDs returns the trimmed non empty ids, sorted
+func sortedIDs(ids []string) []string {
+	sorted := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id = strings.TrimSpace(id); len(id) > 0 {
+			sorted = append(sorted, id)
+		}
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+func toCreateProject(spec config.Project) (*worker.ReqCreateProject, error) {
+	expiration := spec.Expiration
+	if len(expiration) == 0 {
+		expiration = defaultExpiration
+	}
+
+	expireTime, err := worker.ParseExpiration(expiration, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("project %s %s", spec.Name, err.Error())
+	}
+	expiration = worker.FormatExpiration(expireTime)
+
+	ver := worker.Version(0)
+	if len(spec.Version) > 0 {
+		if ver, err = worker.ParseVersion(spec.Version); err != nil {
+			return nil, fmt.Errorf("project %s %s", spec.Name, err.Error())
+		}
+	}
+
+	base := worker.ProjectBase{Name: spec.Name, BundleURL: spec.BundleURL, Replicas: spec.Replicas}
+	return &worker.ReqCreateProject{Region: spec.Region, ProjectBase: base, NodeIDs: spec.NodeIDs, AreaID: spec.AreaID, Expiration: expiration, Version: ver}, nil
+}
+
+func applyOne(w worker.Worker, action *applyAction) error {
+	switch action.action {
+	case actionCreate:
+		return w.CreateProject(action.create)
+	case actionUpdate:
+		return w.UpldateProject(action.update)
+	case actionDelete:
+		return w.DeleteProject(action.projectID)
+	case actionReplace:
+		if err := w.DeleteProject(action.projectID); err != nil {
+			return err
+		}
+		return w.CreateProject(action.create)
+	}
+	return fmt.Errorf("unknown action %s", action.action)
+}
+
+func printApplyPlan(actions []*applyAction) {
+	tw := tablewriter.New(
+		tablewriter.Col("Action"),
+		tablewriter.Col("Name"),
+		tablewriter.Col("ProjectID"),
+		tablewriter.Col("Changes"),
+	)
+
+	for _, action := range actions {
+		m := map[string]interface{}{
+			"Action":    action.action,
+			"Name":      action.name,
+			"ProjectID": action.projectID,
+			"Changes":   action.changes,
+		}
+		tw.Write(m)
+	}
+
+	tw.Flush(os.Stdout)
+}
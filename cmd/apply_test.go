@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	worker "github.com/zscboy/titan-workers-sdk"
+	"github.com/zscboy/titan-workers-sdk/config"
+)
+
+func TestPlanApply(t *testing.T) {
+	created := time.Now().Add(-24 * time.Hour)
+	ver, _ := worker.ParseVersion("1.0.0")
+	deployed := func() *worker.Project {
+		return &worker.Project{
+			ID:          "p1",
+			AreaID:      "area",
+			Region:      "region",
+			Version:     ver,
+			CreatedTime: worker.FormatExpiration(created),
+			Expiration:  worker.FormatExpiration(created.Add(30 * 24 * time.Hour)),
+			ProjectBase: worker.ProjectBase{Name: "web", BundleURL: "https://bundle/v1", Replicas: 2},
+		}
+	}
+	spec := func() config.Project {
+		return config.Project{Name: "web", BundleURL: "https://bundle/v1", AreaID: "area", Region: "region", Replicas: 2}
+	}
+	nodes := map[string][]string{"p1": {"n2", "n1"}}
+
+	tests := []struct {
+		name     string
+		projects []*worker.Project
+		spec     func(p *config.Project)
+		opts     applyOptions
+		// want is the action and changes of each action, err the substring of the error
+		want []string
+		err  string
+	}{
+		{name: "up to date", spec: func(p *config.Project) {}},
+		{name: "up to date with all fields", spec: func(p *config.Project) {
+			p.NodeIDs, p.Expiration, p.Version = "n1, n2", "30d", "1.0.0"
+		}},
+		{name: "create", projects: []*worker.Project{}, spec: func(p *config.Project) {},
+			want: []string{"create bundle_url=https://bundle/v1 replicas=2 area_id=area region=region"}},
+		{name: "not created if some accounts failed", projects: []*worker.Project{}, spec: func(p *config.Project) {}, opts: applyOptions{partial: true}},
+		{name: "update bundle and replicas", spec: func(p *config.Project) { p.BundleURL, p.Replicas = "https://bundle/v2", 3 },
+			want: []string{"update bundle_url: https://bundle/v1 -> https://bundle/v2, replicas: 2 -> 3"}},
+		{name: "update expiration", spec: func(p *config.Project) { p.Expiration = "60d" },
+			want: []string{"update expiration"}},
+		{name: "area changed", spec: func(p *config.Project) { p.AreaID = "other" },
+			err: "web (area_id: area -> other)"},
+		{name: "region changed", spec: func(p *config.Project) { p.Region = "other" },
+			err: "region: region -> other"},
+		{name: "node ids changed", spec: func(p *config.Project) { p.NodeIDs = "n1,n3" },
+			err: "node_ids: n1,n2 -> n1,n3"},
+		{name: "version changed", spec: func(p *config.Project) { p.Version = "1.1.0" },
+			err: "version: 1.0.0 -> 1.1.0"},
+		{name: "replace", spec: func(p *config.Project) { p.Region, p.Replicas = "other", 3 }, opts: applyOptions{recreate: true},
+			want: []string{"replace region: region -> other, replicas: 2 -> 3"}},
+		{name: "expiration in the past", spec: func(p *config.Project) { p.Expiration = "12h" },
+			err: "in the past"},
+		{name: "prune", projects: []*worker.Project{deployed(), {ID: "p2", ProjectBase: worker.ProjectBase{Name: "old"}}}, spec: func(p *config.Project) {}, opts: applyOptions{prune: true},
+			want: []string{"delete"}},
+		{name: "no prune", projects: []*worker.Project{deployed(), {ID: "p2", ProjectBase: worker.ProjectBase{Name: "old"}}}, spec: func(p *config.Project) {}},
+		{name: "duplicate names", projects: []*worker.Project{deployed(), deployed()}, spec: func(p *config.Project) {},
+			err: "more than one project named web"},
+		{name: "duplicate names not in the spec", projects: []*worker.Project{deployed(), {ID: "p2", ProjectBase: worker.ProjectBase{Name: "multi"}}, {ID: "p3", ProjectBase: worker.ProjectBase{Name: "multi"}}},
+			spec: func(p *config.Project) {}},
+		{name: "prune duplicate names not in the spec", projects: []*worker.Project{deployed(), {ID: "p2", ProjectBase: worker.ProjectBase{Name: "multi"}}, {ID: "p3", ProjectBase: worker.ProjectBase{Name: "multi"}}},
+			spec: func(p *config.Project) {}, opts: applyOptions{prune: true}, want: []string{"delete", "delete"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			projects := tt.projects
+			if projects == nil {
+				projects = []*worker.Project{deployed()}
+			}
+			s := spec()
+			tt.spec(&s)
+
+			actions, err := planApply(projects, nodes, &config.Projects{Projects: []config.Project{s}}, tt.opts)
+			if len(tt.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error %v, expect %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(actions) != len(tt.want) {
+				t.Fatalf("%d actions, expect %d", len(actions), len(tt.want))
+			}
+			for i, action := range actions {
+				if got := action.action + " " + action.changes; !strings.HasPrefix(got, tt.want[i]) {
+					t.Fatalf("action %q, expect %q", got, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	worker "github.com/zscboy/titan-workers-sdk"
+	"github.com/zscboy/titan-workers-sdk/tablewriter"
+)
+
+// bulkConcurrency is the max count of projects to change at the same time
+const bulkConcurrency = 8
+
+// openTTY open the terminal to read the confirmation when stdin is used by --stdin
+var openTTY = func() (*os.File, error) {
+	return os.Open("/dev/tty")
+}
+
+// projectSelector match the projects of a bulk operation, all the set fields must match
+type projectSelector struct {
+	nameGlob  string
+	areaID    string
+	status    string
+	olderThan time.Duration
+	// ids is read from stdin, nil if not set
+	ids map[string]bool
+}
+
+// addSelectorFlags add the flags of projectSelector to cmd
+func addSelectorFlags(cmd *cobra.Command) {
+	cmd.Flags().String("select-name", "", "Select the projects whose name match the glob, e.g. sample-*")
+	cmd.Flags().String("select-area-id", "", "Select the projects of the area-id")
+	cmd.Flags().String("select-status", "", "Select the projects of the status")
+	cmd.Flags().String("older-than", "", "Select the projects created before the duration, e.g. 30d")
+	cmd.Flags().Bool("stdin", false, "Select the projects whose id are read from stdin, one per line, the confirmation is read from the terminal")
+	cmd.Flags().BoolP("yes", "y", false, "Run without confirmation")
+}
+
+// parseSelector returns nil if no selector flag is set
+func parseSelector(cmd *cobra.Command) (*projectSelector, error) {
+	sel := &projectSelector{}
+
+	var err error
+	if sel.nameGlob, err = cmd.Flags().GetString("select-name"); err != nil {
+		return nil, err
+	}
+
+	if _, err := path.Match(sel.nameGlob, ""); err != nil {
+		return nil, fmt.Errorf("invalid --select-name %s", sel.nameGlob)
+	}
+
+	if sel.areaID, err = cmd.Flags().GetString("select-area-id"); err != nil {
+		return nil, err
+	}
+
+	if sel.status, err = cmd.Flags().GetString("select-status"); err != nil {
+		return nil, err
+	}
+
+	olderThan, err := cmd.Flags().GetString("older-than")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(olderThan) > 0 {
+		if sel.olderThan, err = worker.ParseDuration(olderThan); err != nil {
+			return nil, err
+		}
+	}
+
+	stdin, err := cmd.Flags().GetBool("stdin")
+	if err != nil {
+		return nil, err
+	}
+
+	if stdin {
+		// the confirmation can not be read from stdin after the ids, but from the terminal
+		if yes, _ := cmd.Flags().GetBool("yes"); !yes {
+			tty, err := openTTY()
+			if err != nil {
+				return nil, fmt.Errorf("--stdin must be used with --yes without a terminal: %s", err.Error())
+			}
+			tty.Close()
+		}
+
+		if sel.ids, err = readIDs(os.Stdin); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(sel.nameGlob) == 0 && len(sel.areaID) == 0 && len(sel.status) == 0 && sel.olderThan == 0 && sel.ids == nil {
+		return nil, nil
+	}
+	return sel, nil
+}
+
+func readIDs(f *os.File) (map[string]bool, error) {
+	ids := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if id := strings.TrimSpace(scanner.Text()); len(id) > 0 {
+			ids[id] = true
+		}
+	}
+	return ids, scanner.Err()
+}
+
+func (sel *projectSelector) match(project *worker.Project, now time.Time) bool {
+	if sel.ids != nil && !sel.ids[project.ID] {
+		return false
+	}
+
+	if len(sel.nameGlob) > 0 {
+		if ok, _ := path.Match(sel.nameGlob, project.Name); !ok {
+			return false
+		}
+	}
+
+	if len(sel.areaID) > 0 && project.AreaID != sel.areaID {
+		return false
+	}
+
+	if len(sel.status) > 0 && project.Status != sel.status {
+		return false
+	}
+
+	if sel.olderThan > 0 {
+		createTime, err := project.CreateTime()
+		if err != nil {
+			log.Warnf("project %s %s, skip it", project.ID, err.Error())
+			return false
+		}
+
+		if createTime.After(now.Add(-sel.olderThan)) {
+			return false
+		}
+	}
+	return true
+}
+
+// selectProjects returns the projects of all pages which match sel
+func selectProjects(w worker.Worker, sel *projectSelector) ([]*worker.Project, error) {
+	projects, err := worker.NewProjectIterator(w, 50).All(context.Background())
+	if worker.IsPartial(err) {
+		log.Warnf("list projects: %s, the projects of the failed accounts are not selected", err.Error())
+	} else if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	selected := make([]*worker.Project, 0)
+	found := make(map[string]bool)
+	for _, project := range projects {
+		if sel.match(project, now) {
+			selected = append(selected, project)
+			found[project.ID] = true
+		}
+	}
+
+	for id := range sel.ids {
+		if !found[id] {
+			log.Warnf("project %s does not exist", id)
+		}
+	}
+	return selected, nil
+}
+
+// runBulk select the projects, print them, ask for confirmation if not --yes,
+// then call fn for each one concurrently and print the failures
+func runBulk(cmd *cobra.Command, w worker.Worker, sel *projectSelector, operation string, fn func(*worker.Project) error) error {
+	yes, err := cmd.Flags().GetBool("yes")
+	if err != nil {
+		return err
+	}
+
+	projects, err := selectProjects(w, sel)
+	if err != nil {
+		return err
+	}
+
+	if len(projects) == 0 {
+		fmt.Println("no project matched")
+		return nil
+	}
+
+	printSelectedProjects(projects)
+	if !yes {
+		in := io.Reader(os.Stdin)
+		if sel.ids != nil {
+			tty, err := openTTY()
+			if err != nil {
+				return fmt.Errorf("can not read the confirmation, %s", err.Error())
+			}
+			defer tty.Close()
+			in = tty
+		}
+
+		if !confirmFrom(in, fmt.Sprintf("%s %d projects?", operation, len(projects))) {
+			fmt.Println("canceled")
+			return nil
+		}
+	}
+
+	errs := make([]error, len(projects))
+	sem := make(chan struct{}, bulkConcurrency)
+	var wg sync.WaitGroup
+	for i, project := range projects {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, project *worker.Project) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = fn(project)
+		}(i, project)
+	}
+	wg.Wait()
+
+	failed := countErrors(errs)
+	fmt.Printf("%s %d projects, %d success, %d failed\n", operation, len(projects), len(projects)-failed, failed)
+	if failed == 0 {
+		return nil
+	}
+
+	printBulkFailures(projects, errs)
+	return fmt.Errorf("%d of %d projects failed", failed, len(projects))
+}
+
+func printSelectedProjects(projects []*worker.Project) {
+	tw := tablewriter.New(
+		tablewriter.Col("ProjectID"),
+		tablewriter.Col("Name"),
+		tablewriter.Col("Status"),
+		tablewriter.Col("AreaID"),
+		tablewriter.Col("Region"),
+		tablewriter.Col("Expiration"),
+	)
+
+	for _, project := range projects {
+		m := map[string]interface{}{
+			"ProjectID":  project.ID,
+			"Name":       project.Name,
+			"Status":     project.Status,
+			"AreaID":     project.AreaID,
+			"Region":     project.Region,
+			"Expiration": project.Expiration,
+		}
+		tw.Write(m)
+	}
+
+	tw.Flush(os.Stdout)
+}
+
+func printBulkFailures(projects []*worker.Project, errs []error) {
+	tw := tablewriter.New(
+		tablewriter.Col("ProjectID"),
+		tablewriter.Col("Name"),
+		tablewriter.Col("Error"),
+	)
+
+	for i, project := range projects {
+		if errs[i] == nil {
+			continue
+		}
+
+		m := map[string]interface{}{
+			"ProjectID": project.ID,
+			"Name":      project.Name,
+			"Error":     errs[i].Error(),
+		}
+		tw.Write(m)
+	}
+
+	tw.Flush(os.Stdout)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	worker "github.com/zscboy/titan-workers-sdk"
+	"github.com/zscboy/titan-workers-sdk/workertest"
+)
+
+// newSelectorCmd returns a command with the selector flags set to flags
+func newSelectorCmd(t *testing.T, flags map[string]string) *cobra.Command {
+	t.Helper()
+
+	cmd := &cobra.Command{}
+	addSelectorFlags(cmd)
+	for name, value := range flags {
+		if err := cmd.Flags().Set(name, value); err != nil {
+			t.Fatalf("set --%s %s", name, err.Error())
+		}
+	}
+	return cmd
+}
+
+// fakeTTY make openTTY return a terminal which answer, or fail if answer is empty
+func fakeTTY(t *testing.T, answer string) {
+	t.Helper()
+
+	saved := openTTY
+	t.Cleanup(func() {
+		openTTY = saved
+	})
+
+	openTTY = func() (*os.File, error) {
+		if len(answer) == 0 {
+			return nil, fmt.Errorf("no terminal")
+		}
+
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		w.WriteString(answer)
+		w.Close()
+		return r, nil
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	fakeTTY(t, "")
+
+	tests := []struct {
+		name  string
+		flags map[string]string
+		want  *projectSelector
+		err   string
+	}{
+		{name: "no selector", flags: map[string]string{"yes": "true"}},
+		{name: "name", flags: map[string]string{"select-name": "web-*"}, want: &projectSelector{nameGlob: "web-*"}},
+		{name: "invalid name", flags: map[string]string{"select-name": "web-["}, err: "invalid --select-name"},
+		{
+			name:  "all",
+			flags: map[string]string{"select-area-id": "area", "select-status": "running", "older-than": "30d"},
+			want:  &projectSelector{areaID: "area", status: "running", olderThan: 30 * 24 * time.Hour},
+		},
+		{name: "invalid older than", flags: map[string]string{"older-than": "old"}, err: "old"},
+		{name: "stdin without yes nor terminal", flags: map[string]string{"stdin": "true"}, err: "--yes"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sel, err := parseSelector(newSelectorCmd(t, test.flags))
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, expect %q", err, test.err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("parseSelector %s", err.Error())
+			}
+
+			if test.want == nil {
+				if sel != nil {
+					t.Fatalf("selector %#v, expect nil", sel)
+				}
+				return
+			}
+
+			if sel == nil || !reflect.DeepEqual(sel, test.want) {
+				t.Fatalf("selector %#v, expect %#v", sel, test.want)
+			}
+		})
+	}
+}
+
+func TestSelectorMatch(t *testing.T) {
+	now := time.Now()
+	project := &worker.Project{
+		ID:          "p1",
+		Status:      "running",
+		AreaID:      "area",
+		CreatedTime: worker.FormatExpiration(now.Add(-48 * time.Hour)),
+		ProjectBase: worker.ProjectBase{Name: "web-1"},
+	}
+
+	tests := []struct {
+		name string
+		sel  projectSelector
+		want bool
+	}{
+		{"empty", projectSelector{}, true},
+		{"name", projectSelector{nameGlob: "web-*"}, true},
+		{"other name", projectSelector{nameGlob: "db-*"}, false},
+		{"area", projectSelector{areaID: "area"}, true},
+		{"other area", projectSelector{areaID: "other"}, false},
+		{"status", projectSelector{status: "running"}, true},
+		{"other status", projectSelector{status: "stopped"}, false},
+		{"older", projectSelector{olderThan: 24 * time.Hour}, true},
+		{"newer", projectSelector{olderThan: 72 * time.Hour}, false},
+		{"ids", projectSelector{ids: map[string]bool{"p1": true}}, true},
+		{"other ids", projectSelector{ids: map[string]bool{"p2": true}}, false},
+		{"all fields must match", projectSelector{nameGlob: "web-*", areaID: "other"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.sel.match(project, now); got != test.want {
+				t.Fatalf("match %v, expect %v", got, test.want)
+			}
+		})
+	}
+
+	noCreateTime := *project
+	noCreateTime.CreatedTime = ""
+	sel := projectSelector{olderThan: time.Hour}
+	if sel.match(&noCreateTime, now) {
+		t.Fatalf("match a project without created time")
+	}
+}
+
+func TestRunBulk(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	w, err := worker.NewWorker(s.Config(), worker.WithRetryPolicy(worker.NoRetry()))
+	if err != nil {
+		t.Fatalf("NewWorker %s", err.Error())
+	}
+
+	for _, name := range []string{"web-1", "web-2", "web-3", "db-1"} {
+		s.AddProject(&worker.PorjectInfo{Name: name, AreaID: "area", Replicas: 1}, "region")
+	}
+
+	cmd := newSelectorCmd(t, map[string]string{"yes": "true"})
+	var lock sync.Mutex
+	called := make([]string, 0)
+	err = runBulk(cmd, w, &projectSelector{nameGlob: "web-*"}, "test", func(project *worker.Project) error {
+		lock.Lock()
+		called = append(called, project.Name)
+		lock.Unlock()
+
+		if project.Name == "web-2" {
+			return fmt.Errorf("failed")
+		}
+		return nil
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 projects failed") {
+		t.Fatalf("runBulk error %v, expect 1 of 3 projects failed", err)
+	}
+
+	if len(called) != 3 {
+		t.Fatalf("called %v, expect the 3 web projects", called)
+	}
+
+	err = runBulk(cmd, w, &projectSelector{nameGlob: "none-*"}, "test", func(project *worker.Project) error {
+		t.Fatalf("called for %s", project.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("runBulk without match %s", err.Error())
+	}
+}
+
+func TestRunBulkConfirmFromTTY(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	w, err := worker.NewWorker(s.Config())
+	if err != nil {
+		t.Fatalf("NewWorker %s", err.Error())
+	}
+	id := s.AddProject(&worker.PorjectInfo{Name: "web", Replicas: 1}, "region")
+
+	// the ids are read from stdin, so is not the confirmation
+	sel := &projectSelector{ids: map[string]bool{id: true}}
+	for _, answer := range []string{"n\n", "y\n"} {
+		fakeTTY(t, answer)
+
+		called := false
+		err := runBulk(newSelectorCmd(t, nil), w, sel, "test", func(project *worker.Project) error {
+			called = true
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("runBulk %s", err.Error())
+		}
+
+		if called != (answer == "y\n") {
+			t.Fatalf("answer %q called %v", answer, called)
+		}
+	}
+
+	fakeTTY(t, "")
+	if err := runBulk(newSelectorCmd(t, nil), w, sel, "test", func(*worker.Project) error { return nil }); err == nil {
+		t.Fatalf("runBulk without terminal expect error")
+	}
+}
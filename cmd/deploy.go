@@ -1,27 +1,32 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"os"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/spf13/cobra"
 	worker "github.com/zscboy/titan-workers-sdk"
 	"github.com/zscboy/titan-workers-sdk/config"
+	"github.com/zscboy/titan-workers-sdk/tablewriter"
 )
 
-func deploy(cmd *cobra.Command, args []string) error {
-	areaID, err := cmd.Flags().GetString("area-id")
-	if len(areaID) == 0 || err != nil {
-		return fmt.Errorf("Must set --area-id")
-	}
+// defaultExpiration is the expiration of the project if not set
+const defaultExpiration = "100d"
+
+// deployTarget is an area and region to deploy the project
+type deployTarget struct {
+	areaID string
+	region string
+}
 
-	region, err := cmd.Flags().GetString("region")
-	if len(region) == 0 || err != nil {
-		return fmt.Errorf("Must set --region")
+func deploy(cmd *cobra.Command, args []string) error {
+	targets, err := deployTargets(cmd)
+	if err != nil {
+		return err
 	}
 
 	name, err := cmd.Flags().GetString("name")
@@ -50,18 +55,33 @@ func deploy(cmd *cobra.Command, args []string) error {
 	}
 
 	if len(expiration) == 0 {
-		expireTime := time.Now().Add(100 * 24 * time.Hour)
-		expiration = expireTime.Format("2006-01-02 15:04:05")
+		expiration = defaultExpiration
+	}
+
+	expireTime, err := worker.ParseExpiration(expiration, time.Now())
+	if err != nil {
+		return err
 	}
+	expiration = worker.FormatExpiration(expireTime)
 
 	version, err := cmd.Flags().GetString("version")
 	if err != nil {
 		return err
 	}
 
-	ver := uint32(0)
+	wait, err := cmd.Flags().GetBool("wait")
+	if err != nil {
+		return err
+	}
+
+	waitTimeout, err := cmd.Flags().GetDuration("wait-timeout")
+	if err != nil {
+		return err
+	}
+
+	ver := worker.Version(0)
 	if len(version) > 0 {
-		ver, err = versionToInt(version)
+		ver, err = worker.ParseVersion(version)
 		if err != nil {
 			return err
 		}
@@ -84,40 +104,219 @@ func deploy(cmd *cobra.Command, args []string) error {
 	// fmt.Println("config ", *cfg)
 	// fmt.Println("nodes ", nodes)
 
-	wConfig := &worker.Config{UserName: cfg.Server.UserName, Password: cfg.Server.Password, APIServer: cfg.Server.URL}
-	w, err := worker.NewWorker(wConfig)
+	w, err := newWorker(cfg)
 	if err != nil {
-		return fmt.Errorf("NewWorker ", err.Error())
+		return fmt.Errorf("NewWorker %s", err.Error())
+	}
+
+	// the create api does not return the project id, remember the projects
+	// which have the same name to find the new one after created
+	existProjectIDs := make(map[string]bool)
+	if wait {
+		if existProjectIDs, err = projectIDsWithName(w, name); err != nil {
+			return err
+		}
 	}
 
 	base := worker.ProjectBase{Name: name, BundleURL: bundleURL, Replicas: replicas}
-	req := &worker.ReqCreateProject{Region: region, ProjectBase: base, NodeIDs: nodes, AreaID: areaID, Expiration: expiration, Version: int(ver)}
-	buf, _ := json.Marshal(req)
-	fmt.Printf("req %s \n", string(buf))
-	// _ = w
-	return w.CreateProject(req)
-}
+	reqs := make([]*worker.ReqCreateProject, 0, len(targets))
+	for _, target := range targets {
+		req := &worker.ReqCreateProject{Region: target.region, ProjectBase: base, NodeIDs: nodes, AreaID: target.areaID, Expiration: expiration, Version: ver}
+		reqs = append(reqs, req)
+	}
+
+	errs := createProjects(w, reqs)
+	printDeployResults(reqs, errs)
+	if failed := countErrors(errs); failed > 0 {
+		return fmt.Errorf("%d of %d targets failed", failed, len(reqs))
+	}
 
-func versionToInt(version string) (uint32, error) {
-	vers := strings.Split(version, ".")
-	if len(vers) != 3 {
-		return 0, fmt.Errorf("invalid version %s", version)
+	if !wait {
+		return nil
 	}
 
-	major, err := strconv.Atoi(vers[0])
+	projectIDs, err := projectIDsWithName(w, name)
 	if err != nil {
-		return 0, fmt.Errorf("parse version major %s failed %s", vers[0], err.Error())
+		return err
 	}
 
-	minor, err := strconv.Atoi(vers[1])
+	newProjectIDs := make([]string, 0, len(reqs))
+	for projectID := range projectIDs {
+		if !existProjectIDs[projectID] {
+			newProjectIDs = append(newProjectIDs, projectID)
+		}
+	}
+
+	if len(newProjectIDs) == 0 {
+		return fmt.Errorf("can not find the created project %s", name)
+	}
+
+	for _, projectID := range newProjectIDs {
+		fmt.Printf("project %s created, waiting for %d replicas\n", projectID, replicas)
+		if err := waitProjectReady(w, projectID, replicas, nil, waitTimeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deployTargets returns the targets of --target and --targets-file,
+// or the target of --area-id and --region if neither is set
+func deployTargets(cmd *cobra.Command) ([]deployTarget, error) {
+	targetStrs, err := cmd.Flags().GetStringArray("target")
 	if err != nil {
-		return 0, fmt.Errorf("parse version minor %s failed %s", vers[1], err.Error())
+		return nil, err
 	}
 
-	patch, err := strconv.Atoi(vers[2])
+	targetsFile, err := cmd.Flags().GetString("targets-file")
 	if err != nil {
-		return 0, fmt.Errorf("parse version patch %s failed %s", vers[2], err.Error())
+		return nil, err
+	}
+
+	if len(targetsFile) > 0 {
+		buf, err := os.ReadFile(targetsFile)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, line := range strings.Split(string(buf), "\n") {
+			line = strings.TrimSpace(line)
+			if len(line) == 0 || strings.HasPrefix(line, "#") {
+				continue
+			}
+			targetStrs = append(targetStrs, line)
+		}
+	}
+
+	if len(targetStrs) == 0 {
+		areaID, err := cmd.Flags().GetString("area-id")
+		if len(areaID) == 0 || err != nil {
+			return nil, fmt.Errorf("Must set --area-id or --target")
+		}
+
+		region, err := cmd.Flags().GetString("region")
+		if len(region) == 0 || err != nil {
+			return nil, fmt.Errorf("Must set --region")
+		}
+		return []deployTarget{{areaID: areaID, region: region}}, nil
+	}
+
+	targets := make([]deployTarget, 0, len(targetStrs))
+	exists := make(map[deployTarget]bool)
+	for _, targetStr := range targetStrs {
+		areaID, region, ok := strings.Cut(targetStr, ":")
+		target := deployTarget{areaID: strings.TrimSpace(areaID), region: strings.TrimSpace(region)}
+		if !ok || len(target.areaID) == 0 || len(target.region) == 0 || strings.Contains(target.region, ":") {
+			return nil, fmt.Errorf("invalid target %s, must be area-id:region", targetStr)
+		}
+
+		if exists[target] {
+			continue
+		}
+		exists[target] = true
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// createProjects create the projects concurrently, errs[i] is the error of reqs[i]
+func createProjects(w worker.Worker, reqs []*worker.ReqCreateProject) []error {
+	errs := make([]error, len(reqs))
+
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		go func(i int, req *worker.ReqCreateProject) {
+			defer wg.Done()
+			errs[i] = w.CreateProject(req)
+		}(i, req)
+	}
+	wg.Wait()
+
+	return errs
+}
+
+func countErrors(errs []error) int {
+	count := 0
+	for _, err := range errs {
+		if err != nil {
+			count++
+		}
+	}
+	return count
+}
+
+func printDeployResults(reqs []*worker.ReqCreateProject, errs []error) {
+	tw := tablewriter.New(
+		tablewriter.Col("AreaID"),
+		tablewriter.Col("Region"),
+		tablewriter.Col("Result"),
+		tablewriter.Col("Error"),
+	)
+
+	for i, req := range reqs {
+		m := map[string]interface{}{
+			"AreaID": req.AreaID,
+			"Region": req.Region,
+			"Result": "success",
+			"Error":  "",
+		}
+		if errs[i] != nil {
+			m["Result"] = "failed"
+			m["Error"] = errs[i].Error()
+		}
+		tw.Write(m)
+	}
+
+	tw.Flush(os.Stdout)
+}
+
+func projectIDsWithName(w worker.Worker, name string) (map[string]bool, error) {
+	projects, err := worker.NewProjectIterator(w, 50).All(context.Background())
+	if worker.IsPartial(err) {
+		log.Warnf("list projects: %s", err.Error())
+	} else if err != nil {
+		return nil, err
+	}
+
+	projectIDs := make(map[string]bool)
+	for _, project := range projects {
+		if project.Name == name {
+			projectIDs[project.ID] = true
+		}
+	}
+	return projectIDs, nil
+}
+
+// waitProjectReady wait until replicas nodes of the project are started, and print the progress.
+// The stale nodes are counted only after they restarted, see worker.WaitOptions.StaleNodes
+func waitProjectReady(w worker.Worker, projectID string, replicas int, staleNodes []string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	lastStarted := -1
+	opts := worker.WaitOptions{
+		Replicas:   replicas,
+		StaleNodes: staleNodes,
+		OnTransition: func(t worker.NodeTransition) {
+			if t.From < 0 {
+				fmt.Printf("node %s %s\n", t.NodeID, t.To.String())
+				return
+			}
+			fmt.Printf("node %s %s -> %s\n", t.NodeID, t.From.String(), t.To.String())
+		},
+		OnProgress: func(started, replicas int) {
+			if started != lastStarted {
+				fmt.Printf("%d/%d replicas started\n", started, replicas)
+				lastStarted = started
+			}
+		},
+	}
+
+	if _, err := worker.WaitForProjectReady(ctx, w, projectID, opts); err != nil {
+		return err
 	}
 
-	return uint32(major)<<16 | uint32(minor)<<8 | uint32(patch), nil
+	fmt.Printf("project %s is ready\n", projectID)
+	return nil
 }
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	worker "github.com/zscboy/titan-workers-sdk"
+	"github.com/zscboy/titan-workers-sdk/workertest"
+)
+
+func newDeployCmd(t *testing.T, flags map[string][]string) *cobra.Command {
+	t.Helper()
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("area-id", "", "")
+	cmd.Flags().String("region", "", "")
+	cmd.Flags().StringArray("target", nil, "")
+	cmd.Flags().String("targets-file", "", "")
+	cmd.Flags().String("name", "", "")
+	cmd.Flags().String("bundle-url", "", "")
+	cmd.Flags().String("nodes", "", "")
+	cmd.Flags().Int("replicas", 100, "")
+	cmd.Flags().String("expiration", "", "")
+	cmd.Flags().String("version", "", "")
+	cmd.Flags().Bool("wait", false, "")
+	cmd.Flags().Duration("wait-timeout", time.Minute, "")
+	for name, values := range flags {
+		for _, value := range values {
+			if err := cmd.Flags().Set(name, value); err != nil {
+				t.Fatalf("set --%s %s", name, err.Error())
+			}
+		}
+	}
+	return cmd
+}
+
+func TestDeployTargets(t *testing.T) {
+	targetsFile := filepath.Join(t.TempDir(), "targets")
+	content := "# targets\nasia:china\n\n europe : germany \nasia:china\n"
+	if err := os.WriteFile(targetsFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		flags map[string][]string
+		want  []deployTarget
+		err   string
+	}{
+		{name: "area and region", flags: map[string][]string{"area-id": {"asia"}, "region": {"china"}},
+			want: []deployTarget{{areaID: "asia", region: "china"}}},
+		{name: "no area", flags: map[string][]string{"region": {"china"}}, err: "--area-id"},
+		{name: "no region", flags: map[string][]string{"area-id": {"asia"}}, err: "--region"},
+		{name: "targets", flags: map[string][]string{"target": {"asia:china", " europe:germany", "asia:china"}, "area-id": {"ignored"}},
+			want: []deployTarget{{areaID: "asia", region: "china"}, {areaID: "europe", region: "germany"}}},
+		{name: "targets file", flags: map[string][]string{"target": {"america:usa"}, "targets-file": {targetsFile}},
+			want: []deployTarget{{areaID: "america", region: "usa"}, {areaID: "asia", region: "china"}, {areaID: "europe", region: "germany"}}},
+		{name: "no colon", flags: map[string][]string{"target": {"asia"}}, err: "invalid target asia"},
+		{name: "no area id", flags: map[string][]string{"target": {" :china"}}, err: "invalid target"},
+		{name: "no region of target", flags: map[string][]string{"target": {"asia:"}}, err: "invalid target"},
+		{name: "two colons", flags: map[string][]string{"target": {"asia:china:x"}}, err: "invalid target"},
+		{name: "targets file not exist", flags: map[string][]string{"targets-file": {targetsFile + ".none"}}, err: "no such file"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			targets, err := deployTargets(newDeployCmd(t, test.flags))
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, expect %q", err, test.err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("deployTargets %s", err.Error())
+			}
+
+			if !reflect.DeepEqual(targets, test.want) {
+				t.Fatalf("targets %v, expect %v", targets, test.want)
+			}
+		})
+	}
+}
+
+func TestCreateProjects(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	w, err := worker.NewWorker(s.Config())
+	if err != nil {
+		t.Fatalf("NewWorker %s", err.Error())
+	}
+
+	reqs := make([]*worker.ReqCreateProject, 0)
+	for _, region := range []string{"china", "germany", "usa"} {
+		reqs = append(reqs, &worker.ReqCreateProject{AreaID: "area", Region: region, ProjectBase: worker.ProjectBase{Name: "web", BundleURL: "https://bundle", Replicas: 1}})
+	}
+
+	// one of the targets fail, the others are created
+	s.InjectFault("/api/v1/project/create", 1, workertest.Fault{StatusCode: http.StatusBadRequest})
+	errs := createProjects(w, reqs)
+	if failed := countErrors(errs); failed != 1 {
+		t.Fatalf("%d targets failed, expect 1: %v", failed, errs)
+	}
+
+	projects, err := w.GetProjects(0, 10)
+	if err != nil {
+		t.Fatalf("GetProjects %s", err.Error())
+	}
+
+	created := make(map[string]bool)
+	for _, project := range projects {
+		created[project.Region] = true
+	}
+
+	for i, req := range reqs {
+		if created[req.Region] == (errs[i] != nil) {
+			t.Fatalf("region %s created %v with error %v", req.Region, created[req.Region], errs[i])
+		}
+	}
+}
+
+func TestDeploy(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	configPath := writeConfig(t, s)
+	base := map[string][]string{"name": {"web"}, "bundle-url": {"https://bundle"}, "replicas": {"1"}}
+	withFlags := func(flags map[string][]string) map[string][]string {
+		for name, values := range base {
+			flags[name] = values
+		}
+		return flags
+	}
+
+	// a single target prints the results table like several targets
+	var err error
+	output := captureStdout(t, func() {
+		err = deploy(newDeployCmd(t, withFlags(map[string][]string{"area-id": {"asia"}, "region": {"china"}})), []string{configPath})
+	})
+	if err != nil {
+		t.Fatalf("deploy %s", err.Error())
+	}
+
+	if !strings.Contains(output, "asia") || !strings.Contains(output, "success") || strings.Contains(output, "req {") {
+		t.Fatalf("deploy output %q, expect the results table", output)
+	}
+
+	s.InjectFault("/api/v1/project/create", 1, workertest.Fault{StatusCode: http.StatusBadRequest})
+	output = captureStdout(t, func() {
+		err = deploy(newDeployCmd(t, withFlags(map[string][]string{"target": {"asia:china", "europe:germany", "america:usa"}})), []string{configPath})
+	})
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 targets failed") {
+		t.Fatalf("deploy error %v, expect 1 of 3 targets failed", err)
+	}
+
+	if strings.Count(output, "success") != 2 || strings.Count(output, "failed") != 1 {
+		t.Fatalf("deploy output %q, expect 2 success and 1 failed", output)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
 
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/spf13/cobra"
@@ -54,15 +55,35 @@ func execute() {
 
 	deployCmd.Flags().String("area-id", "", "Specifying the area-id(scheduler) for project to deploy")
 	deployCmd.Flags().String("region", "", "Specifying the region for project to deploy")
+	deployCmd.Flags().StringArray("target", nil, "Specifying a area-id:region to deploy, can be repeated")
+	deployCmd.Flags().String("targets-file", "", "Specifying a file of area-id:region to deploy, one per line")
 	deployCmd.Flags().String("name", "", "Specifying the project name")
 	deployCmd.Flags().String("bundle-url", "", "Specifying the bundle url")
 	deployCmd.Flags().String("nodes", "", "Specifying the nodes to deploy project")
 	deployCmd.Flags().Int("replicas", 100, "Specifying the replicas")
-	deployCmd.Flags().String("expiration", "", "Specifying the expiration")
+	deployCmd.Flags().String("expiration", "", "Specifying the expiration, a duration like 30d or a time like 2006-01-02, default 100d")
 	deployCmd.Flags().String("version", "", "Specifying the version")
+	deployCmd.Flags().Bool("wait", false, "Wait until the replicas of project are started")
+	deployCmd.Flags().Duration("wait-timeout", 10*time.Minute, "Specifying how long to wait for the replicas")
+
+	applyCmd.Flags().StringP("file", "f", "", "Specifying the projects file")
+	applyCmd.Flags().Bool("dry-run", false, "Print the changes without applying them")
+	applyCmd.Flags().Bool("prune", false, "Delete the projects which are not in the projects file")
+	applyCmd.Flags().Bool("recreate", false, "Delete and create again the projects whose area_id, region, node_ids or version changed")
 
 	projectInfoCmd.Flags().String("project-id", "", "Specifying the project id")
+	updateProjectCmd.Flags().String("project-id", "", "Specifying the project id")
+	updateProjectCmd.Flags().String("name", "", "Specifying the new project name")
+	updateProjectCmd.Flags().String("bundle-url", "", "Specifying the new bundle url")
+	updateProjectCmd.Flags().Int("replicas", 0, "Specifying the new replicas")
+	updateProjectCmd.Flags().Bool("wait", false, "Wait until the new bundle is running on the replicas")
+	updateProjectCmd.Flags().Duration("wait-timeout", 10*time.Minute, "Specifying how long to wait for the replicas")
+	renewProjectCmd.Flags().String("project-id", "", "Specifying the project id")
+	renewProjectCmd.Flags().String("extend", "", "Specifying how long to extend the expiration, e.g. 30d")
 	deleteProjectCmd.Flags().String("project-id", "", "Specifying the project id")
+	addSelectorFlags(updateProjectCmd)
+	addSelectorFlags(renewProjectCmd)
+	addSelectorFlags(deleteProjectCmd)
 
 	listNodesCmd.Flags().String("area-id", "", "Specifying the area-id to list node")
 	listNodesCmd.Flags().String("region", "", "Specifying the region to list node")
@@ -73,6 +94,7 @@ func execute() {
 
 	listProjectsCmd.Flags().Int("page", 0, "Specifying the page of list")
 	listProjectsCmd.Flags().Int("size", 20, "Specifying the size of page")
+	listProjectsCmd.Flags().String("expiring-within", "", "List the projects of all pages which expire within the duration, e.g. 7d")
 
 	checkDelayCmd.Flags().Int("page", 0, "Specifying the page of list")
 	checkDelayCmd.Flags().Int("size", 20, "Specifying the size of page")
@@ -82,6 +104,7 @@ func execute() {
 	rootCmd.AddCommand(runCmd)
 	// rootCmd.AddCommand(listRegionsCmd)
 	rootCmd.AddCommand(deployCmd)
+	rootCmd.AddCommand(applyCmd)
 
 	// projectCmd.AddCommand(listProjectsCmd, projectInfoCmd)
 	// rootCmd.AddCommand(listProjectsCmd)
@@ -90,6 +113,8 @@ func execute() {
 	listCmd.AddCommand(listRegionsCmd)
 
 	rootCmd.AddCommand(listCmd)
+	projectInfoCmd.AddCommand(updateProjectCmd)
+	projectInfoCmd.AddCommand(renewProjectCmd)
 	rootCmd.AddCommand(projectInfoCmd)
 	rootCmd.AddCommand(deleteProjectCmd)
 	rootCmd.AddCommand(setNodeCmd)
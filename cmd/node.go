@@ -45,14 +45,15 @@ func listNodes(cmd *cobra.Command, args []string) ([]*worker.PorjectInfo, error)
 		return nil, fmt.Errorf("parse config error " + err.Error())
 	}
 
-	wConfig := &worker.Config{UserName: cfg.Server.UserName, Password: cfg.Server.Password, APIServer: cfg.Server.URL}
-	w, err := worker.NewWorker(wConfig)
+	w, err := newWorker(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("NewWorker %s", err.Error())
 	}
 
 	projects, err := w.GetProjects(page, size)
-	if err != nil {
+	if worker.IsPartial(err) {
+		log.Warnf("list projects: %s", err.Error())
+	} else if err != nil {
 		return nil, err
 	}
 
@@ -71,8 +72,19 @@ func listNodes(cmd *cobra.Command, args []string) ([]*worker.PorjectInfo, error)
 var listNodesCmd = &cobra.Command{
 	Use:     "node",
 	Short:   "list all nodes",
-	Example: "node /path/to/config",
+	Example: "node /path/to/config\nnode --area-id=Asia-China-Guangdong-Shenzhen --region=china /path/to/config",
 	Run: func(cmd *cobra.Command, args []string) {
+		if areaID, _ := cmd.Flags().GetString("area-id"); len(areaID) > 0 {
+			nodeList, err := listNodeWithRegion(cmd, args)
+			if err != nil {
+				fmt.Println("list nodes ", err.Error())
+				return
+			}
+
+			printRegionNodes(nodeList)
+			return
+		}
+
 		pInfos, err := listNodes(cmd, args)
 		if err != nil {
 			fmt.Println("list projects ", err.Error())
@@ -101,7 +113,7 @@ var listNodesCmd = &cobra.Command{
 					"NodeID": node.ID,
 					"AreaID": node.AreaID,
 					"IP":     node.IP,
-					"Status": statusToString(node.Status),
+					"Status": node.Status.String(),
 					"url":    node.URL,
 				}
 				tw.Write(m)
@@ -148,11 +160,11 @@ var setNodeCmd = &cobra.Command{
 
 		buf, _ := io.ReadAll(rsp.Body)
 		data := struct {
-			NodeID string `json:"NodeID"`
-			WsURL  string `json:"WsURL"`
-			Status int    `json:"status"`
-			AreaID string `json:"GeoID"`
-			IP     string `json:"IP"`
+			NodeID string            `json:"NodeID"`
+			WsURL  string            `json:"WsURL"`
+			Status worker.NodeStatus `json:"status"`
+			AreaID string            `json:"GeoID"`
+			IP     string            `json:"IP"`
 		}{}
 
 		err = json.Unmarshal(buf, &data)
@@ -172,7 +184,7 @@ var setNodeCmd = &cobra.Command{
 			"NodeID": data.NodeID,
 			"AreaID": data.AreaID,
 			"IP":     data.IP,
-			"Status": statusToString(data.Status),
+			"Status": data.Status.String(),
 		}
 		tw.Write(m)
 
@@ -195,11 +207,11 @@ var queryNodeCmd = &cobra.Command{
 
 		buf, _ := io.ReadAll(rsp.Body)
 		data := struct {
-			NodeID string `json:"NodeID"`
-			WsURL  string `json:"WsURL"`
-			Status int    `json:"status"`
-			AreaID string `json:"GeoID"`
-			IP     string `json:"IP"`
+			NodeID string            `json:"NodeID"`
+			WsURL  string            `json:"WsURL"`
+			Status worker.NodeStatus `json:"status"`
+			AreaID string            `json:"GeoID"`
+			IP     string            `json:"IP"`
 		}{}
 
 		err = json.Unmarshal(buf, &data)
@@ -219,7 +231,7 @@ var queryNodeCmd = &cobra.Command{
 			"NodeID": data.NodeID,
 			"AreaID": data.AreaID,
 			"IP":     data.IP,
-			"Status": statusToString(data.Status),
+			"Status": data.Status.String(),
 		}
 		tw.Write(m)
 
@@ -227,20 +239,6 @@ var queryNodeCmd = &cobra.Command{
 	},
 }
 
-func statusToString(status int) string {
-	if status == 0 {
-		return "starting"
-	} else if status == 1 {
-		return "started"
-	} else if status == 2 {
-		return "failed"
-	} else if status == 3 {
-		return "offline"
-	}
-
-	return "unknow"
-}
-
 var checkDelayCmd = &cobra.Command{
 	Use:     "delay-check",
 	Short:   "check nodes delay",
@@ -270,12 +268,11 @@ var checkDelayCmd = &cobra.Command{
 
 		cfg, err := config.ParseConfig(configFilePath)
 		if err != nil {
-			fmt.Errorf("parse config error " + err.Error())
+			fmt.Println("parse config error " + err.Error())
 			return
 		}
 
-		wConfig := &worker.Config{UserName: cfg.Server.UserName, Password: cfg.Server.Password, APIServer: cfg.Server.URL}
-		w, err := worker.NewWorker(wConfig)
+		w, err := newWorker(cfg)
 		if err != nil {
 			return
 		}
@@ -292,7 +289,7 @@ var checkDelayCmd = &cobra.Command{
 				continue
 			}
 			for _, node := range info.Nodes {
-				if node.Status != 1 {
+				if node.Status != worker.NodeStatusStarted {
 					continue
 				}
 				if len(node.URL) == 0 {
@@ -358,7 +355,7 @@ func delayInfo(header http.Header) (*DelayInfo, error) {
 	userTimestamp := header.Get("User-timestamp")
 	userTimestampInt64, err := strconv.ParseInt(userTimestamp, 10, 64)
 	if err != nil {
-		fmt.Println("parse user timestamp error %s ", err.Error())
+		fmt.Printf("parse user timestamp error %s\n", err.Error())
 		return nil, err
 	}
 
@@ -368,7 +365,7 @@ func delayInfo(header http.Header) (*DelayInfo, error) {
 	for i, timestamp := range strings.Split(requestNodesTimestamps, ",") {
 		nodeTimestamp, err := strconv.ParseInt(strings.TrimSpace(timestamp), 10, 64)
 		if err != nil {
-			fmt.Println("parse node timestamp error %s", err.Error())
+			fmt.Printf("parse node timestamp error %s\n", err.Error())
 			continue
 		}
 		requestMap[strings.TrimSpace(nodes[i])] = nodeTimestamp
@@ -383,7 +380,7 @@ func delayInfo(header http.Header) (*DelayInfo, error) {
 	for i, timestamp := range responseNodesTimestamps {
 		nodeTimestamp, err := strconv.ParseInt(strings.TrimSpace(timestamp), 10, 64)
 		if err != nil {
-			fmt.Println("parse node timestamp error %s", err.Error())
+			fmt.Printf("parse node timestamp error %s\n", err.Error())
 			continue
 		}
 		nodeID := nodes[i]
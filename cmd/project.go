@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
@@ -26,6 +28,18 @@ func listProjects(cmd *cobra.Command, args []string) ([]*worker.Project, error)
 		return nil, fmt.Errorf("Must set --size")
 	}
 
+	expiringWithin, err := cmd.Flags().GetString("expiring-within")
+	if err != nil {
+		return nil, err
+	}
+
+	within := time.Duration(0)
+	if len(expiringWithin) > 0 {
+		if within, err = worker.ParseDuration(expiringWithin); err != nil {
+			return nil, err
+		}
+	}
+
 	configFilePath := args[0]
 	if _, err := os.Stat(configFilePath); os.IsNotExist(err) {
 		return nil, fmt.Errorf("%s does not exist.", configFilePath)
@@ -36,14 +50,45 @@ func listProjects(cmd *cobra.Command, args []string) ([]*worker.Project, error)
 		return nil, fmt.Errorf("parse config error " + err.Error())
 	}
 
-	wConfig := &worker.Config{UserName: cfg.Server.UserName, Password: cfg.Server.Password, APIServer: cfg.Server.URL}
-	w, err := worker.NewWorker(wConfig)
+	w, err := newWorker(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("NewWorker %s", err.Error())
 	}
 
-	return w.GetProjects(page, size)
+	if len(expiringWithin) == 0 {
+		projects, err := w.GetProjects(page, size)
+		if worker.IsPartial(err) {
+			log.Warnf("list projects: %s", err.Error())
+			return projects, nil
+		}
+		return projects, err
+	}
 
+	projects, err := worker.NewProjectIterator(w, size).All(context.Background())
+	if worker.IsPartial(err) {
+		log.Warnf("list projects: %s", err.Error())
+	} else if err != nil {
+		return nil, err
+	}
+	return expiringProjects(projects, time.Now().Add(within)), nil
+}
+
+// expiringProjects returns the projects which expire before deadline,
+// the projects without expiration are skipped
+func expiringProjects(projects []*worker.Project, deadline time.Time) []*worker.Project {
+	expiring := make([]*worker.Project, 0)
+	for _, project := range projects {
+		expireTime, err := project.ExpireTime()
+		if err != nil {
+			log.Warnf("project %s %s", project.ID, err.Error())
+			continue
+		}
+
+		if expireTime.Before(deadline) {
+			expiring = append(expiring, project)
+		}
+	}
+	return expiring
 }
 
 func getProjectInfo(cmd *cobra.Command, args []string) (*worker.PorjectInfo, error) {
@@ -66,8 +111,7 @@ func getProjectInfo(cmd *cobra.Command, args []string) (*worker.PorjectInfo, err
 		return nil, fmt.Errorf("parse config error " + err.Error())
 	}
 
-	wConfig := &worker.Config{UserName: cfg.Server.UserName, Password: cfg.Server.Password, APIServer: cfg.Server.URL}
-	w, err := worker.NewWorker(wConfig)
+	w, err := newWorker(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("NewWorker %s", err.Error())
 	}
@@ -77,8 +121,17 @@ func getProjectInfo(cmd *cobra.Command, args []string) (*worker.PorjectInfo, err
 
 func deleteProjectInfo(cmd *cobra.Command, args []string) error {
 	projectID, err := cmd.Flags().GetString("project-id")
-	if len(projectID) == 0 || err != nil {
-		return fmt.Errorf("Must set --project-id")
+	if err != nil {
+		return err
+	}
+
+	sel, err := parseSelector(cmd)
+	if err != nil {
+		return err
+	}
+
+	if err := checkProjectIDOrSelector(projectID, sel); err != nil {
+		return err
 	}
 
 	if len(args) == 0 {
@@ -95,13 +148,23 @@ func deleteProjectInfo(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("parse config error " + err.Error())
 	}
 
-	wConfig := &worker.Config{UserName: cfg.Server.UserName, Password: cfg.Server.Password, APIServer: cfg.Server.URL}
-	w, err := worker.NewWorker(wConfig)
+	w, err := newWorker(cfg)
 	if err != nil {
 		return fmt.Errorf("NewWorker %s", err.Error())
 	}
 
-	return w.DeleteProject(projectID)
+	if sel != nil {
+		return runBulk(cmd, w, sel, "delete", func(project *worker.Project) error {
+			return w.DeleteProject(project.ID)
+		})
+	}
+
+	if err := w.DeleteProject(projectID); err != nil {
+		return err
+	}
+
+	fmt.Printf("delete %s success\n", projectID)
+	return nil
 }
 
 var listProjectsCmd = &cobra.Command{
@@ -127,16 +190,22 @@ var listProjectsCmd = &cobra.Command{
 			tablewriter.Col("Replicas"),
 			tablewriter.Col("AreaID"),
 			tablewriter.Col("Region"),
+			tablewriter.Col("Version"),
+			tablewriter.Col("Expiration"),
+			tablewriter.Col("Account"),
 		)
 
 		for _, project := range projects {
 			m := map[string]interface{}{
-				"ProjectID": project.ID,
-				"Name":      project.Name,
-				"Status":    project.Status,
-				"Replicas":  project.Replicas,
-				"AreaID":    project.AreaID,
-				"Region":    project.Region,
+				"ProjectID":  project.ID,
+				"Name":       project.Name,
+				"Status":     project.Status,
+				"Replicas":   project.Replicas,
+				"AreaID":     project.AreaID,
+				"Region":     project.Region,
+				"Version":    project.Version.String(),
+				"Expiration": project.Expiration,
+				"Account":    project.Account,
 			}
 
 			tw.Write(m)
@@ -160,6 +229,10 @@ var projectInfoCmd = &cobra.Command{
 		}
 
 		fmt.Println("Project ID: ", projectInfo.ID)
+		fmt.Println("Version: ", projectInfo.Version.String())
+		if len(projectInfo.Expiration) > 0 {
+			fmt.Println("Expiration: ", projectInfo.Expiration)
+		}
 		for _, accessPoint := range projectInfo.Nodes {
 			fmt.Printf("%s %s\n", accessPoint.ID, accessPoint.URL)
 		}
@@ -179,8 +252,5 @@ var deleteProjectCmd = &cobra.Command{
 			fmt.Println(err.Error())
 			return
 		}
-
-		projectID, _ := cmd.Flags().GetString("project-id")
-		fmt.Printf("delete %s success\n", projectID)
 	},
 }
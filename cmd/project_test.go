@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	worker "github.com/zscboy/titan-workers-sdk"
+)
+
+func TestExpiringProjects(t *testing.T) {
+	now := time.Now()
+	projects := []*worker.Project{
+		{ID: "expired", Expiration: worker.FormatExpiration(now.Add(-time.Hour))},
+		{ID: "soon", Expiration: worker.FormatExpiration(now.Add(24 * time.Hour))},
+		{ID: "later", Expiration: worker.FormatExpiration(now.Add(30 * 24 * time.Hour))},
+		{ID: "no expiration"},
+	}
+
+	tests := []struct {
+		name     string
+		deadline time.Time
+		want     []string
+	}{
+		{"now", now, []string{"expired"}},
+		{"7 days", now.Add(7 * 24 * time.Hour), []string{"expired", "soon"}},
+		{"60 days", now.Add(60 * 24 * time.Hour), []string{"expired", "soon", "later"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expiring := expiringProjects(projects, test.deadline)
+			ids := make([]string, 0, len(expiring))
+			for _, project := range expiring {
+				ids = append(ids, project.ID)
+			}
+
+			if len(ids) != len(test.want) {
+				t.Fatalf("expiring %v, expect %v", ids, test.want)
+			}
+			for i := range ids {
+				if ids[i] != test.want[i] {
+					t.Fatalf("expiring %v, expect %v", ids, test.want)
+				}
+			}
+		})
+	}
+}
@@ -32,8 +32,7 @@ func getRegions(cmd *cobra.Command, args []string) (*worker.AreaList, error) {
 		return nil, fmt.Errorf("parse config error %s", err.Error())
 	}
 
-	wConfig := &worker.Config{UserName: cfg.Server.UserName, Password: cfg.Server.Password, APIServer: cfg.Server.URL}
-	w, err := worker.NewWorker(wConfig)
+	w, err := newWorker(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("NewWorker %s", err.Error())
 	}
@@ -41,7 +40,7 @@ func getRegions(cmd *cobra.Command, args []string) (*worker.AreaList, error) {
 	return w.GetRegions(area)
 }
 
-func listNodeWithRegion(cmd *cobra.Command, args []string) ([]string, error) {
+func listNodeWithRegion(cmd *cobra.Command, args []string) (*worker.RegionNodeList, error) {
 	areaID, err := cmd.Flags().GetString("area-id")
 	if len(areaID) == 0 || err != nil {
 		return nil, fmt.Errorf("Must set --area-id")
@@ -52,6 +51,16 @@ func listNodeWithRegion(cmd *cobra.Command, args []string) ([]string, error) {
 		return nil, fmt.Errorf("Must set --region")
 	}
 
+	page, err := cmd.Flags().GetInt("page")
+	if err != nil {
+		return nil, fmt.Errorf("Must set --page")
+	}
+
+	size, err := cmd.Flags().GetInt("size")
+	if size == 0 || err != nil {
+		return nil, fmt.Errorf("Must set --size")
+	}
+
 	if len(args) == 0 {
 		return nil, fmt.Errorf("Please specify the name of the config file")
 	}
@@ -66,13 +75,61 @@ func listNodeWithRegion(cmd *cobra.Command, args []string) ([]string, error) {
 		return nil, fmt.Errorf("parse config error %s", err.Error())
 	}
 
-	wConfig := &worker.Config{UserName: cfg.Server.UserName, Password: cfg.Server.Password, APIServer: cfg.Server.URL}
-	w, err := worker.NewWorker(wConfig)
+	w, err := newWorker(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("NewWorker %s", err.Error())
 	}
 
-	return w.ListNodesWithRegions(areaID, region)
+	return w.ListNodesWithRegions(areaID, region, page, size)
+}
+
+func printRegionNodes(nodeList *worker.RegionNodeList) {
+	if len(nodeList.List) == 0 {
+		fmt.Println("no node exist")
+		return
+	}
+
+	tw := tablewriter.New(
+		tablewriter.Col("Num"),
+		tablewriter.Col("NodeID"),
+		tablewriter.Col("AreaID"),
+		tablewriter.Col("IP"),
+		tablewriter.Col("Status"),
+		tablewriter.Col("CPU"),
+		tablewriter.Col("Memory"),
+		tablewriter.Col("Disk"),
+	)
+
+	for i, node := range nodeList.List {
+		m := map[string]interface{}{
+			"Num":    i,
+			"NodeID": node.ID,
+			"AreaID": node.AreaID,
+			"IP":     node.IP,
+			"Status": node.Status.String(),
+			"CPU":    node.CPUCores,
+			"Memory": formatBytes(node.Memory),
+			"Disk":   formatBytes(node.DiskSpace),
+		}
+		tw.Write(m)
+	}
+
+	tw.Flush(os.Stdout)
+	fmt.Printf(color.YellowString("\nTotal: %d ", nodeList.Total))
+}
+
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(size)/float64(div), "KMGTPE"[exp])
 }
 
 var listRegionsCmd = &cobra.Command{
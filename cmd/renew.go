@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	worker "github.com/zscboy/titan-workers-sdk"
+	"github.com/zscboy/titan-workers-sdk/config"
+)
+
+var renewProjectCmd = &cobra.Command{
+	Use:     "renew",
+	Short:   "extend the expiration of project",
+	Example: "renew --project-id=your-project-id --extend=30d /path/to/config",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := renewProject(cmd, args); err != nil {
+			fmt.Println("renew project ", err.Error())
+		}
+	},
+}
+
+func renewProject(cmd *cobra.Command, args []string) error {
+	projectID, err := cmd.Flags().GetString("project-id")
+	if err != nil {
+		return err
+	}
+
+	sel, err := parseSelector(cmd)
+	if err != nil {
+		return err
+	}
+
+	if err := checkProjectIDOrSelector(projectID, sel); err != nil {
+		return err
+	}
+
+	extend, err := cmd.Flags().GetString("extend")
+	if len(extend) == 0 || err != nil {
+		return fmt.Errorf("Must set --extend")
+	}
+
+	d, err := worker.ParseDuration(extend)
+	if err != nil {
+		return err
+	}
+
+	if d <= 0 {
+		return fmt.Errorf("--extend must be greater than 0")
+	}
+
+	if len(args) == 0 {
+		return fmt.Errorf("Please specify the name of the config file")
+	}
+
+	configFilePath := args[0]
+	if _, err := os.Stat(configFilePath); os.IsNotExist(err) {
+		return fmt.Errorf("%s does not exist.", configFilePath)
+	}
+
+	cfg, err := config.ParseConfig(configFilePath)
+	if err != nil {
+		return fmt.Errorf("parse config error " + err.Error())
+	}
+
+	w, err := newWorker(cfg)
+	if err != nil {
+		return fmt.Errorf("NewWorker %s", err.Error())
+	}
+
+	if sel != nil {
+		return runBulk(cmd, w, sel, "renew", func(project *worker.Project) error {
+			expiration, err := renewExpiration(project, d, time.Now())
+			if err != nil {
+				return err
+			}
+
+			req := &worker.ReqUpdatePorjct{
+				ID:          project.ID,
+				ProjectBase: project.ProjectBase,
+				Expiration:  worker.FormatExpiration(expiration),
+			}
+			return w.UpldateProject(req)
+		})
+	}
+
+	projectInfo, err := w.GetProjectInfo(projectID)
+	if err != nil {
+		return err
+	}
+
+	expiration, err := renewExpiration(projectInfo, d, time.Now())
+	if err != nil {
+		return err
+	}
+
+	req := &worker.ReqUpdatePorjct{
+		ID:          projectID,
+		ProjectBase: worker.ProjectBase{Name: projectInfo.Name, BundleURL: projectInfo.BundleURL, Replicas: projectInfo.Replicas},
+		Expiration:  worker.FormatExpiration(expiration),
+	}
+
+	if err := w.UpldateProject(req); err != nil {
+		return err
+	}
+
+	fmt.Printf("renew %s success, expiration %s -> %s\n", projectID, projectInfo.Expiration, req.Expiration)
+	return nil
+}
+
+// renewExpiration extend the expiration of the project by d, from now if the project has expired.
+// An unknown expiration is an error, extending it from now may shorten it
+func renewExpiration(project interface{ ExpireTime() (time.Time, error) }, d time.Duration, now time.Time) (time.Time, error) {
+	expireTime, err := project.ExpireTime()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("can not renew, %s", err.Error())
+	}
+
+	if expireTime.Before(now) {
+		expireTime = now
+	}
+	return expireTime.Add(d), nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	worker "github.com/zscboy/titan-workers-sdk"
+	"github.com/zscboy/titan-workers-sdk/workertest"
+)
+
+type expireTime struct {
+	t   time.Time
+	err error
+}
+
+func (e expireTime) ExpireTime() (time.Time, error) {
+	return e.t, e.err
+}
+
+func TestRenewExpiration(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local)
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name    string
+		project expireTime
+		want    time.Time
+		err     bool
+	}{
+		{name: "not expired", project: expireTime{t: now.Add(10 * day)}, want: now.Add(40 * day)},
+		{name: "expired", project: expireTime{t: now.Add(-10 * day)}, want: now.Add(30 * day)},
+		{name: "no expiration", project: expireTime{err: fmt.Errorf("no expiration")}, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := renewExpiration(test.project, 30*day, now)
+			if test.err {
+				if err == nil {
+					t.Fatalf("renewExpiration %s, expect error", got)
+				}
+				return
+			}
+
+			if err != nil || !got.Equal(test.want) {
+				t.Fatalf("renewExpiration %s %v, expect %s", got, err, test.want)
+			}
+		})
+	}
+
+	// the expiration of the api can not be parsed
+	for _, expiration := range []string{"", "soon"} {
+		project := &worker.Project{ID: "p1", Expiration: expiration}
+		if got, err := renewExpiration(project, 30*day, now); err == nil {
+			t.Fatalf("renew expiration %q to %s, expect error", expiration, got)
+		}
+	}
+}
+
+// writeConfig write a config file to login to s
+func writeConfig(t *testing.T, s *workertest.Server) string {
+	t.Helper()
+
+	cfg := s.Config()
+	content := fmt.Sprintf("[server]\nuser_name = %q\npassword = %q\nurl = %q\n", cfg.UserName, cfg.Password, cfg.APIServer)
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newRenewCmd(t *testing.T, flags map[string]string) *cobra.Command {
+	t.Helper()
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("project-id", "", "")
+	cmd.Flags().String("extend", "", "")
+	addSelectorFlags(cmd)
+	for name, value := range flags {
+		if err := cmd.Flags().Set(name, value); err != nil {
+			t.Fatalf("set --%s %s", name, err.Error())
+		}
+	}
+	return cmd
+}
+
+func TestRenewProject(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	configPath := writeConfig(t, s)
+	expiration := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	id := s.AddProject(&worker.PorjectInfo{Name: "web-1", Replicas: 1, Expiration: worker.FormatExpiration(expiration)}, "region")
+	other := s.AddProject(&worker.PorjectInfo{Name: "db-1", Replicas: 1, Expiration: worker.FormatExpiration(expiration)}, "region")
+
+	expireTime := func(projectID string) time.Time {
+		t.Helper()
+		et, err := s.ProjectInfo(projectID).ExpireTime()
+		if err != nil {
+			t.Fatalf("project %s %s", projectID, err.Error())
+		}
+		return et
+	}
+
+	cmd := newRenewCmd(t, map[string]string{"project-id": id, "extend": "30d"})
+	if err := renewProject(cmd, []string{configPath}); err != nil {
+		t.Fatalf("renewProject %s", err.Error())
+	}
+
+	if got, want := expireTime(id), expiration.Add(30*24*time.Hour); !got.Equal(want) {
+		t.Fatalf("expiration %s, expect %s", got, want)
+	}
+
+	cmd = newRenewCmd(t, map[string]string{"select-name": "web-*", "extend": "1d", "yes": "true"})
+	if err := renewProject(cmd, []string{configPath}); err != nil {
+		t.Fatalf("renewProject with selector %s", err.Error())
+	}
+
+	if got, want := expireTime(id), expiration.Add(31*24*time.Hour); !got.Equal(want) {
+		t.Fatalf("expiration %s, expect %s", got, want)
+	}
+
+	if got := expireTime(other); !got.Equal(expiration) {
+		t.Fatalf("the unselected project is renewed to %s", got)
+	}
+
+	// a project without expiration is reported, not renewed from now
+	none := s.AddProject(&worker.PorjectInfo{Name: "web-2", Replicas: 1}, "region")
+	cmd = newRenewCmd(t, map[string]string{"select-name": "web-*", "extend": "1d", "yes": "true"})
+	if err := renewProject(cmd, []string{configPath}); err == nil || !strings.Contains(err.Error(), "1 of 2 projects failed") {
+		t.Fatalf("renewProject error %v, expect 1 of 2 projects failed", err)
+	}
+
+	if expiration := s.ProjectInfo(none).Expiration; len(expiration) > 0 {
+		t.Fatalf("the project without expiration is renewed to %s", expiration)
+	}
+
+	if got, want := expireTime(id), expiration.Add(32*24*time.Hour); !got.Equal(want) {
+		t.Fatalf("expiration %s, expect %s", got, want)
+	}
+
+	cmd = newRenewCmd(t, map[string]string{"project-id": none, "extend": "1d"})
+	if err := renewProject(cmd, []string{configPath}); err == nil {
+		t.Fatalf("renewProject without expiration expect error")
+	}
+
+	cmd = newRenewCmd(t, map[string]string{"project-id": id})
+	if err := renewProject(cmd, []string{configPath}); err == nil {
+		t.Fatalf("renewProject without --extend expect error")
+	}
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
+	"time"
 
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/spf13/cobra"
@@ -37,14 +39,15 @@ func run(cmd *cobra.Command, args []string) error {
 	}
 	logging.SetAllLoggers(logLevel)
 
-	wConfig := &worker.Config{UserName: cfg.Server.UserName, Password: cfg.Server.Password, APIServer: cfg.Server.URL}
-	w, err := worker.NewWorker(wConfig)
+	w, err := newWorker(cfg)
 	if err != nil {
 		return err
 	}
 
-	pInfos, err := loadProjects(w)
-	if err != nil {
+	pInfos, err := worker.NewProjectInfoIterator(w, 50).All(context.Background())
+	if worker.IsPartial(err) {
+		log.Warnf("load projects: %s", err.Error())
+	} else if err != nil {
 		return err
 	}
 
@@ -67,8 +70,26 @@ func run(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("Selector type %s not found", cfg.Selector.Type)
 	}
 
+	balancer, err := proxy.NewBalancer(cfg.Tun.Balancer)
+	if err != nil {
+		return err
+	}
+
+	var createTimeout time.Duration
+	if len(cfg.Tun.CreateTimeout) > 0 {
+		createTimeout, err = time.ParseDuration(cfg.Tun.CreateTimeout)
+		if err != nil {
+			return fmt.Errorf("parse tun create timeout %s failed %s", cfg.Tun.CreateTimeout, err.Error())
+		}
+	}
+
 	// tunInfos := []*selector.TunInfo{{URL: cfg.Tun.URL, Auth: cfg.Tun.AuthKey}}
-	tunMgr := proxy.NewTunManager(cfg.Tun.Count, cfg.Tun.Cap, ts)
+	opts := []proxy.Option{
+		proxy.WithFlowWindow(cfg.Tun.Window),
+		proxy.WithBalancer(balancer),
+		proxy.WithCreateRetry(cfg.Tun.CreateAttempts, createTimeout),
+	}
+	tunMgr := proxy.NewTunManager(cfg.Tun.Count, cfg.Tun.Cap, ts, opts...)
 	tunMgr.Startup()
 
 	// go func() {
@@ -92,26 +113,6 @@ func run(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func loadProjects(w worker.Worker) ([]*worker.PorjectInfo, error) {
-	page := 0
-	size := 50
-	pInfos := make([]*worker.PorjectInfo, 0)
-	for {
-		projectInfos, err := w.LoadProjects(page, size)
-		if err != nil {
-			return nil, err
-		}
-
-		pInfos = append(pInfos, projectInfos...)
-		if len(projectInfos) < size {
-			break
-		}
-		page++
-	}
-
-	return pInfos, nil
-}
-
 func filterNodeOrFirst(nodeID string, pInfos []*worker.PorjectInfo) *worker.Node {
 	for _, pInfo := range pInfos {
 		for _, node := range pInfo.Nodes {
@@ -5,7 +5,6 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
-	worker "github.com/zscboy/titan-workers-sdk"
 	"github.com/zscboy/titan-workers-sdk/config"
 )
 
@@ -21,13 +20,13 @@ var listTunnelsCmd = &cobra.Command{
 
 		configFilePath := args[0]
 		if _, err := os.Stat(configFilePath); os.IsNotExist(err) {
-			fmt.Println("Config file %s not exist", configFilePath)
+			fmt.Printf("Config file %s not exist\n", configFilePath)
 			return
 		}
 
 		cfg, err := config.ParseConfig(configFilePath)
 		if err != nil {
-			fmt.Println("Parse config file: %s", err.Error())
+			fmt.Printf("Parse config file: %s\n", err.Error())
 			return
 		}
 
@@ -40,16 +39,15 @@ var listTunnelsCmd = &cobra.Command{
 		// fmt.Println("config ", *cfg)
 		// fmt.Println("nodes ", nodes)
 
-		wConfig := &worker.Config{UserName: cfg.Server.UserName, Password: cfg.Server.Password, APIServer: cfg.Server.URL}
-		w, err := worker.NewWorker(wConfig)
+		w, err := newWorker(cfg)
 		if err != nil {
-			fmt.Println("NewWorker %s", err.Error())
+			fmt.Printf("NewWorker %s\n", err.Error())
 			return
 		}
 
 		tuns, err := w.GetTunnels(projectID)
 		if err != nil {
-			fmt.Println("NewWorker %s", err.Error())
+			fmt.Printf("GetTunnels %s\n", err.Error())
 			return
 		}
 
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	worker "github.com/zscboy/titan-workers-sdk"
+	"github.com/zscboy/titan-workers-sdk/config"
+	"github.com/zscboy/titan-workers-sdk/tablewriter"
+)
+
+var updateProjectCmd = &cobra.Command{
+	Use:     "update",
+	Short:   "update project",
+	Example: "update --project-id=your-project-id --bundle-url=https://your-bundle-url /path/to/config",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := updateProject(cmd, args); err != nil {
+			fmt.Println("update project ", err.Error())
+		}
+	},
+}
+
+func updateProject(cmd *cobra.Command, args []string) error {
+	projectID, err := cmd.Flags().GetString("project-id")
+	if err != nil {
+		return err
+	}
+
+	sel, err := parseSelector(cmd)
+	if err != nil {
+		return err
+	}
+
+	if err := checkProjectIDOrSelector(projectID, sel); err != nil {
+		return err
+	}
+
+	name, err := cmd.Flags().GetString("name")
+	if err != nil {
+		return err
+	}
+
+	bundleURL, err := cmd.Flags().GetString("bundle-url")
+	if err != nil {
+		return err
+	}
+
+	replicas, err := cmd.Flags().GetInt("replicas")
+	if err != nil {
+		return err
+	}
+
+	if len(name) == 0 && len(bundleURL) == 0 && replicas == 0 {
+		return fmt.Errorf("Must set at least one of --name, --bundle-url and --replicas")
+	}
+
+	yes, err := cmd.Flags().GetBool("yes")
+	if err != nil {
+		return err
+	}
+
+	wait, err := cmd.Flags().GetBool("wait")
+	if err != nil {
+		return err
+	}
+
+	waitTimeout, err := cmd.Flags().GetDuration("wait-timeout")
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return fmt.Errorf("Please specify the name of the config file")
+	}
+
+	configFilePath := args[0]
+	if _, err := os.Stat(configFilePath); os.IsNotExist(err) {
+		return fmt.Errorf("%s does not exist.", configFilePath)
+	}
+
+	cfg, err := config.ParseConfig(configFilePath)
+	if err != nil {
+		return fmt.Errorf("parse config error " + err.Error())
+	}
+
+	w, err := newWorker(cfg)
+	if err != nil {
+		return fmt.Errorf("NewWorker %s", err.Error())
+	}
+
+	change := worker.ProjectBase{Name: name, BundleURL: bundleURL, Replicas: replicas}
+	if sel != nil {
+		if wait {
+			return fmt.Errorf("--wait can only be used with --project-id")
+		}
+
+		return runBulk(cmd, w, sel, "update", func(project *worker.Project) error {
+			return w.UpldateProject(newUpdateRequest(project.ID, project.ProjectBase, change))
+		})
+	}
+
+	projectInfo, err := w.GetProjectInfo(projectID)
+	if err != nil {
+		return err
+	}
+
+	current := worker.ProjectBase{Name: projectInfo.Name, BundleURL: projectInfo.BundleURL, Replicas: projectInfo.Replicas}
+	req := newUpdateRequest(projectID, current, change)
+
+	if !printUpdateDiff(projectInfo, req) {
+		fmt.Println("nothing to update")
+		return nil
+	}
+
+	if !yes && !confirm(fmt.Sprintf("Update project %s?", projectID)) {
+		fmt.Println("canceled")
+		return nil
+	}
+
+	if err := w.UpldateProject(req); err != nil {
+		return err
+	}
+	fmt.Printf("update %s success\n", projectID)
+
+	if !wait {
+		return nil
+	}
+
+	// the bundle of the project is changed at once, the nodes run the new bundle once restarted
+	var staleNodes []string
+	if req.BundleURL != projectInfo.BundleURL {
+		for _, node := range projectInfo.ServingNodes() {
+			staleNodes = append(staleNodes, node.ID)
+		}
+	}
+	return waitProjectReady(w, projectID, req.Replicas, staleNodes, waitTimeout)
+}
+
+// newUpdateRequest returns the request to apply the set fields of change to the project,
+// the api replace all fields, so the fields not set keep the current values
+func newUpdateRequest(projectID string, current, change worker.ProjectBase) *worker.ReqUpdatePorjct {
+	req := &worker.ReqUpdatePorjct{ID: projectID, ProjectBase: current}
+	if len(change.Name) > 0 {
+		req.Name = change.Name
+	}
+	if len(change.BundleURL) > 0 {
+		req.BundleURL = change.BundleURL
+	}
+	if change.Replicas > 0 {
+		req.Replicas = change.Replicas
+	}
+	return req
+}
+
+// checkProjectIDOrSelector check that one and only one of --project-id and the selector is set
+func checkProjectIDOrSelector(projectID string, sel *projectSelector) error {
+	if len(projectID) == 0 && sel == nil {
+		return fmt.Errorf("Must set --project-id or a selector")
+	}
+
+	if len(projectID) > 0 && sel != nil {
+		return fmt.Errorf("Can not set both --project-id and a selector")
+	}
+	return nil
+}
+
+// printUpdateDiff print the fields to change, returns false if nothing changes
+func printUpdateDiff(projectInfo *worker.PorjectInfo, req *worker.ReqUpdatePorjct) bool {
+	tw := tablewriter.New(
+		tablewriter.Col("Field"),
+		tablewriter.Col("Current"),
+		tablewriter.Col("Requested"),
+	)
+
+	changes := 0
+	diff := func(field string, current, requested interface{}) {
+		if current == requested {
+			return
+		}
+		tw.Write(map[string]interface{}{"Field": field, "Current": current, "Requested": requested})
+		changes++
+	}
+
+	diff("Name", projectInfo.Name, req.Name)
+	diff("BundleURL", projectInfo.BundleURL, req.BundleURL)
+	diff("Replicas", projectInfo.Replicas, req.Replicas)
+
+	if changes == 0 {
+		return false
+	}
+
+	tw.Flush(os.Stdout)
+	return true
+}
+
+// confirm ask the user on the terminal, returns true only if the answer is yes
+func confirm(prompt string) bool {
+	return confirmFrom(os.Stdin, prompt)
+}
+
+// confirmFrom ask the user and read the answer from r
+func confirmFrom(r io.Reader, prompt string) bool {
+	fmt.Printf("%s [y/N]: ", prompt)
+
+	answer, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	worker "github.com/zscboy/titan-workers-sdk"
+	"github.com/zscboy/titan-workers-sdk/workertest"
+)
+
+func TestNewUpdateRequest(t *testing.T) {
+	current := worker.ProjectBase{Name: "web", BundleURL: "https://bundle/v1", Replicas: 2}
+
+	tests := []struct {
+		name   string
+		change worker.ProjectBase
+		want   worker.ProjectBase
+	}{
+		{"nothing set", worker.ProjectBase{}, current},
+		{"name", worker.ProjectBase{Name: "api"}, worker.ProjectBase{Name: "api", BundleURL: "https://bundle/v1", Replicas: 2}},
+		{"bundle", worker.ProjectBase{BundleURL: "https://bundle/v2"}, worker.ProjectBase{Name: "web", BundleURL: "https://bundle/v2", Replicas: 2}},
+		{"replicas", worker.ProjectBase{Replicas: 5}, worker.ProjectBase{Name: "web", BundleURL: "https://bundle/v1", Replicas: 5}},
+		{"all", worker.ProjectBase{Name: "api", BundleURL: "https://bundle/v2", Replicas: 5}, worker.ProjectBase{Name: "api", BundleURL: "https://bundle/v2", Replicas: 5}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := newUpdateRequest("p1", current, test.change)
+			if req.ID != "p1" || req.ProjectBase != test.want {
+				t.Fatalf("request %#v, expect %#v", req.ProjectBase, test.want)
+			}
+		})
+	}
+}
+
+// captureStdout returns what fn prints on stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() {
+		os.Stdout = stdout
+	}()
+
+	output := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		output <- string(b)
+	}()
+
+	fn()
+	w.Close()
+	return <-output
+}
+
+func TestPrintUpdateDiff(t *testing.T) {
+	info := &worker.PorjectInfo{ID: "p1", Name: "web", BundleURL: "https://bundle/v1", Replicas: 2}
+
+	var changed bool
+	output := captureStdout(t, func() {
+		req := newUpdateRequest(info.ID, worker.ProjectBase{Name: info.Name, BundleURL: info.BundleURL, Replicas: info.Replicas}, worker.ProjectBase{BundleURL: "https://bundle/v2"})
+		changed = printUpdateDiff(info, req)
+	})
+
+	if !changed || !strings.Contains(output, "https://bundle/v1") || !strings.Contains(output, "https://bundle/v2") {
+		t.Fatalf("diff %v %q, expect the bundle change", changed, output)
+	}
+
+	// the fields not changed are not printed
+	if strings.Contains(output, "Replicas") || strings.Contains(output, "Name") {
+		t.Fatalf("diff %q print the unchanged fields", output)
+	}
+
+	output = captureStdout(t, func() {
+		req := newUpdateRequest(info.ID, worker.ProjectBase{Name: info.Name, BundleURL: info.BundleURL, Replicas: info.Replicas}, worker.ProjectBase{Replicas: 2})
+		changed = printUpdateDiff(info, req)
+	})
+
+	if changed || len(output) > 0 {
+		t.Fatalf("diff %v %q, expect nothing to update", changed, output)
+	}
+}
+
+func newUpdateCmd(t *testing.T, flags map[string]string) *cobra.Command {
+	t.Helper()
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("project-id", "", "")
+	cmd.Flags().String("name", "", "")
+	cmd.Flags().String("bundle-url", "", "")
+	cmd.Flags().Int("replicas", 0, "")
+	cmd.Flags().Bool("wait", false, "")
+	cmd.Flags().Duration("wait-timeout", time.Minute, "")
+	addSelectorFlags(cmd)
+	for name, value := range flags {
+		if err := cmd.Flags().Set(name, value); err != nil {
+			t.Fatalf("set --%s %s", name, err.Error())
+		}
+	}
+	return cmd
+}
+
+func TestUpdateProject(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	configPath := writeConfig(t, s)
+	id := s.AddProject(&worker.PorjectInfo{Name: "web", BundleURL: "https://bundle/v1", Replicas: 2}, "region")
+
+	// the fields not set keep their values
+	cmd := newUpdateCmd(t, map[string]string{"project-id": id, "bundle-url": "https://bundle/v2", "yes": "true"})
+	if err := updateProject(cmd, []string{configPath}); err != nil {
+		t.Fatalf("updateProject %s", err.Error())
+	}
+
+	info := s.ProjectInfo(id)
+	if info.Name != "web" || info.BundleURL != "https://bundle/v2" || info.Replicas != 2 {
+		t.Fatalf("project %#v after update", info)
+	}
+
+	// nothing changed, no request
+	calls := s.Calls("/api/v1/project/update")
+	cmd = newUpdateCmd(t, map[string]string{"project-id": id, "replicas": "2", "yes": "true"})
+	if err := updateProject(cmd, []string{configPath}); err != nil {
+		t.Fatalf("updateProject %s", err.Error())
+	}
+
+	if s.Calls("/api/v1/project/update") != calls {
+		t.Fatalf("update sent without change")
+	}
+
+	cmd = newUpdateCmd(t, map[string]string{"project-id": id})
+	if err := updateProject(cmd, []string{configPath}); err == nil {
+		t.Fatalf("updateProject without change expect error")
+	}
+}
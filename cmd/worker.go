@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	worker "github.com/zscboy/titan-workers-sdk"
+	"github.com/zscboy/titan-workers-sdk/config"
+)
+
+// newWorker login to the api servers of the accounts in config,
+// the accounts are aggregated by a MultiWorker if there are more than one
+func newWorker(cfg *config.Config) (worker.Worker, error) {
+	servers := cfg.AccountServers()
+	if len(servers) == 1 {
+		return newServerWorker(servers[0])
+	}
+
+	accounts := make([]worker.Account, 0, len(servers))
+	for _, server := range servers {
+		name := server.Name
+		if len(name) == 0 {
+			name = server.UserName
+		}
+
+		w, err := newServerWorker(server)
+		if err != nil {
+			return nil, fmt.Errorf("account %s %s", name, err.Error())
+		}
+		accounts = append(accounts, worker.Account{Name: name, Worker: w})
+	}
+	return worker.NewMultiWorker(accounts...)
+}
+
+// newServerWorker login to the api server with the client options set in config
+func newServerWorker(server config.Server) (worker.Worker, error) {
+	// the requests are logged at debug level
+	opts := []worker.Option{worker.WithMiddleware(worker.LoggingMiddleware())}
+	if len(server.Timeout) > 0 {
+		timeout, err := time.ParseDuration(server.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("parse server timeout %s failed %s", server.Timeout, err.Error())
+		}
+		opts = append(opts, worker.WithTimeout(timeout))
+	}
+
+	if len(server.Proxy) > 0 {
+		opts = append(opts, worker.WithProxy(server.Proxy))
+	}
+
+	if len(server.UserAgent) > 0 {
+		opts = append(opts, worker.WithUserAgent(server.UserAgent))
+	}
+
+	if len(server.CAFile) > 0 {
+		opts = append(opts, worker.WithCACertFile(server.CAFile))
+	}
+
+	if len(server.CertFile) > 0 || len(server.KeyFile) > 0 {
+		opts = append(opts, worker.WithClientCertificate(server.CertFile, server.KeyFile))
+	}
+
+	wConfig := &worker.Config{UserName: server.UserName, Password: server.Password, APIServer: server.URL}
+	w, err := worker.NewWorker(wConfig, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if server.Cache {
+		return worker.NewCachedWorker(w, worker.DefaultCacheConfig()), nil
+	}
+	return w, nil
+}
@@ -7,6 +7,7 @@ import (
 // Config represents the structure of the TOML file
 type Config struct {
 	Server          Server          `toml:"server"`
+	Servers         []Server        `toml:"servers"` // replace Server to use several accounts at once
 	Node            Node            `toml:"node"`
 	Socks5          Socks5          `toml:"socks5"`
 	Http            Http            `toml:"http"`
@@ -17,9 +18,24 @@ type Config struct {
 }
 
 type Server struct {
+	// optional, the name of the account, default user_name
+	Name     string `toml:"name"`
 	UserName string `toml:"user_name"`
 	Password string `toml:"password"`
 	URL      string `toml:"url"`
+
+	// optional, timeout of a single api request, e.g. "30s"
+	Timeout string `toml:"timeout"`
+	// optional, http proxy to reach the api server, e.g. "http://127.0.0.1:3128"
+	Proxy     string `toml:"proxy"`
+	UserAgent string `toml:"user_agent"`
+	// optional, PEM CA bundle to verify the api server
+	CAFile string `toml:"ca_file"`
+	// optional, client certificate and key for mutual TLS
+	CertFile string `toml:"cert_file"`
+	KeyFile  string `toml:"key_file"`
+	// optional, cache project infos, regions and tunnels in memory
+	Cache bool `toml:"cache"`
 }
 
 type Node struct {
@@ -52,6 +68,17 @@ type LocalHttpServer struct {
 type Tun struct {
 	Count int `toml:"count"`
 	Cap   int `toml:"cap"`
+	// optional, the flow control window of a request in bytes, 0 disables it.
+	// Only enable it if the server support the flow control, it's not negotiated and
+	// the requests hang once they sent window bytes to a server which does not
+	Window int `toml:"window"`
+	// optional, how a request pick its tunnel: round-robin (default), least-active,
+	// latency-weighted or random-two-choices
+	Balancer string `toml:"balancer"`
+	// optional, the count of tunnels tried to create a request, default 3
+	CreateAttempts int `toml:"create_attempts"`
+	// optional, the timeout to create a request on a tunnel, e.g. "5s"
+	CreateTimeout string `toml:"create_timeout"`
 
 	URL     string `toml:"url"`
 	AuthKey string `toml:"authKey"`
@@ -61,6 +88,14 @@ type Log struct {
 	Level string `toml:"level"`
 }
 
+// AccountServers returns Servers if set, else Server
+func (c *Config) AccountServers() []Server {
+	if len(c.Servers) > 0 {
+		return c.Servers
+	}
+	return []Server{c.Server}
+}
+
 func ParseConfig(filePath string) (*Config, error) {
 	var config Config
 
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Projects is the desired state of the projects, used by apply
+type Projects struct {
+	Projects []Project `toml:"projects"`
+}
+
+// Project describe a project to deploy, the name is the key to match the deployed project
+type Project struct {
+	Name      string `toml:"name"`
+	BundleURL string `toml:"bundle_url"`
+	AreaID    string `toml:"area_id"`
+	Region    string `toml:"region"`
+	Replicas  int    `toml:"replicas"`
+	// optional, comma separated node ids
+	NodeIDs string `toml:"node_ids"`
+	// optional, a duration like "30d" or a time like "2006-01-02 15:04:05", default "100d"
+	Expiration string `toml:"expiration"`
+	// optional, e.g. "1.0.0"
+	Version string `toml:"version"`
+}
+
+func ParseProjects(filePath string) (*Projects, error) {
+	var projects Projects
+
+	if _, err := toml.DecodeFile(filePath, &projects); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	for i, project := range projects.Projects {
+		if len(project.Name) == 0 {
+			return nil, fmt.Errorf("projects[%d] name is empty", i)
+		}
+
+		if names[project.Name] {
+			return nil, fmt.Errorf("duplicate project name %s", project.Name)
+		}
+		names[project.Name] = true
+
+		if len(project.BundleURL) == 0 || len(project.AreaID) == 0 || len(project.Region) == 0 {
+			return nil, fmt.Errorf("project %s must set bundle_url, area_id and region", project.Name)
+		}
+
+		if project.Replicas <= 0 {
+			return nil, fmt.Errorf("project %s replicas must be greater than 0", project.Name)
+		}
+	}
+	return &projects, nil
+}
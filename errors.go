@@ -0,0 +1,130 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnauthorized means the token or the user name and password were rejected
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrNotFound means the requested project or resource does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrRateLimited means the api server refused the request for too many calls
+	ErrRateLimited = errors.New("rate limited")
+)
+
+// APIError is returned by the Worker methods when the api server answers a request
+// with a failed http status or with a non-zero Result.Code.
+// Network failures are returned as they are, so they never match APIError
+type APIError struct {
+	// Endpoint is the path of the api, e.g. /api/v1/project/info
+	Endpoint string
+	// StatusCode is the http status of the response
+	StatusCode int
+	// Code is Result.Code, 0 if the body is not a Result
+	Code    int
+	Message string
+	// RetryAfter is the wait asked by the Retry-After header of the response, 0 if none
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.StatusCode != http.StatusOK {
+		return fmt.Sprintf("%s status code %d, %s", e.Endpoint, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("%s code %d, %s", e.Endpoint, e.Code, e.Message)
+}
+
+// Is make errors.Is(err, ErrUnauthorized) and the other sentinel errors
+// match by the http status or by the Result.Code which carries the same value
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.Code == codeUnauthorized
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound || e.Code == codeNotFound
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests || e.Code == codeRateLimited
+	}
+	return false
+}
+
+// ProjectError is the failure to get the info of one project
+type ProjectError struct {
+	ProjectID string
+	Err       error
+}
+
+func (e *ProjectError) Error() string {
+	return fmt.Sprintf("project %s: %s", e.ProjectID, e.Err.Error())
+}
+
+func (e *ProjectError) Unwrap() error {
+	return e.Err
+}
+
+// ProjectErrors is returned with the loaded infos when the infos of some projects
+// could not be loaded, the infos of the other projects are still valid
+type ProjectErrors []*ProjectError
+
+func (errs ProjectErrors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("load %d projects failed: %s", len(errs), strings.Join(msgs, "; "))
+}
+
+func (errs ProjectErrors) Unwrap() []error {
+	unwrapped := make([]error, 0, len(errs))
+	for _, err := range errs {
+		unwrapped = append(unwrapped, err)
+	}
+	return unwrapped
+}
+
+// IsPartial report whether err only reports the failed projects or accounts,
+// as ProjectErrors or AccountErrors, so the results returned along with it are valid
+func IsPartial(err error) bool {
+	var projectErrs ProjectErrors
+	var accountErrs AccountErrors
+	return errors.As(err, &projectErrs) || errors.As(err, &accountErrs)
+}
+
+// AccountError is the failure of one account of a MultiWorker
+type AccountError struct {
+	Account string
+	Err     error
+}
+
+func (e *AccountError) Error() string {
+	return fmt.Sprintf("account %s: %s", e.Account, e.Err.Error())
+}
+
+func (e *AccountError) Unwrap() error {
+	return e.Err
+}
+
+// AccountErrors is returned with the projects of the other accounts when some
+// accounts of a MultiWorker failed, the returned projects are still valid
+type AccountErrors []*AccountError
+
+func (errs AccountErrors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d accounts failed: %s", len(errs), strings.Join(msgs, "; "))
+}
+
+func (errs AccountErrors) Unwrap() []error {
+	unwrapped := make([]error, 0, len(errs))
+	for _, err := range errs {
+		unwrapped = append(unwrapped, err)
+	}
+	return unwrapped
+}
@@ -0,0 +1,95 @@
+package worker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExpirationLayout is the time layout of the expiration of the api
+const ExpirationLayout = "2006-01-02 15:04:05"
+
+// expirationLayouts are the layouts accepted by ParseExpiration, the api returns one of them
+var expirationLayouts = []string{ExpirationLayout, time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"}
+
+// ParseDuration is like time.ParseDuration, and also accept a count of days
+// before the other units, e.g. "30d" or "1d12h"
+func ParseDuration(s string) (time.Duration, error) {
+	days, rest, ok := strings.Cut(s, "d")
+	if !ok {
+		return time.ParseDuration(s)
+	}
+
+	n, err := strconv.Atoi(days)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid duration %s", s)
+	}
+
+	d := time.Duration(n) * 24 * time.Hour
+	if len(rest) == 0 {
+		return d, nil
+	}
+
+	restDuration, err := time.ParseDuration(rest)
+	if err != nil || restDuration < 0 {
+		return 0, fmt.Errorf("invalid duration %s", s)
+	}
+	return d + restDuration, nil
+}
+
+// ParseExpiration parse s as a duration after now like "30d" or "12h",
+// or as a time like "2026-12-31" or "2026-12-31 08:00:00" in the local time zone
+func ParseExpiration(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return time.Time{}, fmt.Errorf("empty expiration")
+	}
+
+	if d, err := ParseDuration(s); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("expiration %s must be after now", s)
+		}
+		return now.Add(d), nil
+	}
+
+	for _, layout := range expirationLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid expiration %s, must be a duration like 30d or a time like 2006-01-02 15:04:05", s)
+}
+
+// FormatExpiration format t in ExpirationLayout for the api
+func FormatExpiration(t time.Time) string {
+	return t.Local().Format(ExpirationLayout)
+}
+
+// ExpireTime returns the expiration of the project, an error if the api did not return it
+func (p *Project) ExpireTime() (time.Time, error) {
+	return parseAPITime("expiration", p.Expiration)
+}
+
+// CreateTime returns the time the project was created, an error if the api did not return it
+func (p *Project) CreateTime() (time.Time, error) {
+	return parseAPITime("created time", p.CreatedTime)
+}
+
+// ExpireTime returns the expiration of the project, an error if the api did not return it
+func (info *PorjectInfo) ExpireTime() (time.Time, error) {
+	return parseAPITime("expiration", info.Expiration)
+}
+
+func parseAPITime(name, value string) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, fmt.Errorf("no %s", name)
+	}
+
+	for _, layout := range expirationLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid %s %s", name, value)
+}
@@ -0,0 +1,67 @@
+package worker_test
+
+import (
+	"testing"
+	"time"
+
+	worker "github.com/zscboy/titan-workers-sdk"
+	"github.com/zscboy/titan-workers-sdk/workertest"
+)
+
+func TestParseExpiration(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.Local)
+
+	tests := []struct {
+		s    string
+		want time.Time
+	}{
+		{"30d", now.Add(30 * 24 * time.Hour)},
+		{"12h", now.Add(12 * time.Hour)},
+		{"1d12h", now.Add(36 * time.Hour)},
+		{"2026-12-31", time.Date(2026, 12, 31, 0, 0, 0, 0, time.Local)},
+		{"2026-12-31 08:00:00", time.Date(2026, 12, 31, 8, 0, 0, 0, time.Local)},
+	}
+	for _, test := range tests {
+		got, err := worker.ParseExpiration(test.s, now)
+		if err != nil {
+			t.Fatalf("ParseExpiration(%q): %v", test.s, err)
+		}
+
+		if !got.Equal(test.want) {
+			t.Fatalf("ParseExpiration(%q) = %v, want %v", test.s, got, test.want)
+		}
+	}
+
+	for _, s := range []string{"", "0d", "-1h", "xd", "30x", "2026-13-01"} {
+		if _, err := worker.ParseExpiration(s, now); err == nil {
+			t.Fatalf("ParseExpiration(%q) should fail", s)
+		}
+	}
+}
+
+func TestRenewProject(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	w := newTestWorker(t, s)
+	id := s.AddProject(&worker.PorjectInfo{Name: "renew", BundleURL: "https://bundle", Replicas: 1, Expiration: "2026-01-02 00:00:00"}, "china")
+
+	req := &worker.ReqUpdatePorjct{ID: id, ProjectBase: worker.ProjectBase{Name: "renew", BundleURL: "https://bundle", Replicas: 1}, Expiration: "2026-02-01 00:00:00"}
+	if err := w.UpldateProject(req); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := w.GetProjectInfo(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expireTime, err := info.ExpireTime()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := time.Date(2026, 2, 1, 0, 0, 0, 0, time.Local); !expireTime.Equal(want) {
+		t.Fatalf("expiration %v, want %v", expireTime, want)
+	}
+}
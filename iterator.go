@@ -0,0 +1,207 @@
+package worker
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrIteratorDone is returned by Next after the last page
+var ErrIteratorDone = errors.New("no more pages")
+
+// ProjectIterator walk all pages of GetProjects
+type ProjectIterator struct {
+	worker Worker
+	page   int
+	size   int
+	done   bool
+}
+
+// NewProjectIterator returns an iterator starting at page 0, size is the count of projects per page
+func NewProjectIterator(w Worker, size int) *ProjectIterator {
+	if size <= 0 {
+		size = defaultPageSize
+	}
+	return &ProjectIterator{worker: w, size: size}
+}
+
+// Next returns the next page of projects, or ErrIteratorDone after the last page.
+// The failed accounts of a MultiWorker are returned as AccountErrors along with
+// the page of the other accounts. If it returns another error, the same page
+// is requested again by the next call
+func (it *ProjectIterator) Next(ctx context.Context) ([]*Project, error) {
+	if it.done {
+		return nil, ErrIteratorDone
+	}
+
+	projects, err := it.worker.GetProjectsCtx(ctx, it.page, it.size)
+	var accountErrs AccountErrors
+	if err != nil && !errors.As(err, &accountErrs) {
+		return nil, err
+	}
+
+	it.page++
+	// a short page is the last page
+	if len(projects) < it.size {
+		it.done = true
+	}
+
+	if len(projects) == 0 && err == nil {
+		return nil, ErrIteratorDone
+	}
+	return projects, err
+}
+
+// All returns the projects of all the remaining pages,
+// the failed accounts of all pages are returned as AccountErrors at the end
+func (it *ProjectIterator) All(ctx context.Context) ([]*Project, error) {
+	all := make([]*Project, 0)
+	var errs AccountErrors
+	for {
+		projects, err := it.Next(ctx)
+		if err == ErrIteratorDone {
+			break
+		}
+
+		var accountErrs AccountErrors
+		if errors.As(err, &accountErrs) {
+			errs = append(errs, accountErrs...)
+		} else if err != nil {
+			return nil, err
+		}
+		all = append(all, projects...)
+	}
+
+	if len(errs) > 0 {
+		return all, errs
+	}
+	return all, nil
+}
+
+// ProjectInfoIterator walk all pages of projects like LoadProjects,
+// it returns only the projects which have serving nodes, with only those nodes.
+// Unlike looping on LoadProjects, it stops by the count of projects of a page,
+// not by the count of the projects which have serving nodes
+//
+// Like LoadProjects, the projects whose info fail to load are skipped
+// and reported as ProjectErrors along with the loaded infos, and the failed
+// accounts of a MultiWorker are reported as AccountErrors
+type ProjectInfoIterator struct {
+	worker      Worker
+	projects    *ProjectIterator
+	concurrency int
+}
+
+// NewProjectInfoIterator returns an iterator starting at page 0, size is the count of projects per page.
+// The infos are loaded with the concurrency option of w
+func NewProjectInfoIterator(w Worker, size int) *ProjectInfoIterator {
+	return &ProjectInfoIterator{worker: w, projects: NewProjectIterator(w, size), concurrency: concurrencyOf(w)}
+}
+
+// concurrencyOf returns the concurrency option of the worker created by NewWorker,
+// the sum of the options of the accounts of a MultiWorker
+func concurrencyOf(w Worker) int {
+	switch wk := w.(type) {
+	case *worker:
+		return wk.concurrency
+	case *CachedWorker:
+		return concurrencyOf(wk.worker)
+	case *MultiWorker:
+		// the accounts may be on different api servers, each one can take its own concurrency
+		concurrency := 0
+		for _, account := range wk.accounts {
+			concurrency += concurrencyOf(account.Worker)
+		}
+		return concurrency
+	}
+	return defaultConcurrency
+}
+
+// Next returns the infos of the next page, it may be empty when no project
+// of the page has serving nodes. Returns ErrIteratorDone after the last page
+func (it *ProjectInfoIterator) Next(ctx context.Context) ([]*PorjectInfo, error) {
+	pInfos := make([]*PorjectInfo, 0)
+	accountErrs, err := it.next(ctx, func(pInfo *PorjectInfo) error {
+		pInfos = append(pInfos, pInfo)
+		return nil
+	})
+
+	var projectErrs ProjectErrors
+	if err != nil && !errors.As(err, &projectErrs) {
+		return nil, err
+	}
+	return pInfos, partialErrors(accountErrs, projectErrs)
+}
+
+// All returns the infos of all the remaining pages
+func (it *ProjectInfoIterator) All(ctx context.Context) ([]*PorjectInfo, error) {
+	all := make([]*PorjectInfo, 0)
+	partial, err := it.each(ctx, func(pInfo *PorjectInfo) error {
+		all = append(all, pInfo)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return all, partial
+}
+
+// Each stream the infos of all the remaining pages to fn as soon as each one arrives,
+// an error returned by fn stops the iteration and is returned by Each.
+// The failed projects and accounts of all pages are returned as ProjectErrors
+// and AccountErrors at the end
+func (it *ProjectInfoIterator) Each(ctx context.Context, fn func(*PorjectInfo) error) error {
+	partial, err := it.each(ctx, fn)
+	if err != nil {
+		return err
+	}
+	return partial
+}
+
+// each returns the ProjectErrors and AccountErrors of all pages as partial,
+// and the error which stopped the iteration as err
+func (it *ProjectInfoIterator) each(ctx context.Context, fn func(*PorjectInfo) error) (partial error, err error) {
+	var errs ProjectErrors
+	var accountErrs AccountErrors
+	for {
+		pageAccountErrs, err := it.next(ctx, fn)
+		accountErrs = append(accountErrs, pageAccountErrs...)
+		if err == ErrIteratorDone {
+			break
+		}
+
+		var projectErrs ProjectErrors
+		if errors.As(err, &projectErrs) {
+			errs = append(errs, projectErrs...)
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+	return partialErrors(accountErrs, errs), nil
+}
+
+// next load the infos of the next page, the failed accounts of the page are returned as accountErrs
+func (it *ProjectInfoIterator) next(ctx context.Context, fn func(*PorjectInfo) error) (AccountErrors, error) {
+	projects, err := it.projects.Next(ctx)
+	var accountErrs AccountErrors
+	if err != nil && !errors.As(err, &accountErrs) {
+		return nil, err
+	}
+	return accountErrs, loadProjectInfos(ctx, it.worker, projects, it.concurrency, fn)
+}
+
+// partialErrors returns the errors of the failed accounts and projects, nil if none failed
+func partialErrors(accountErrs AccountErrors, projectErrs ProjectErrors) error {
+	switch {
+	case len(accountErrs) > 0 && len(projectErrs) > 0:
+		return errors.Join(accountErrs, projectErrs)
+	case len(accountErrs) > 0:
+		return accountErrs
+	case len(projectErrs) > 0:
+		return projectErrs
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
 
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/zscboy/titan-workers-sdk/config"
@@ -42,8 +43,26 @@ func run(args []string) error {
 	}
 	logging.SetAllLoggers(logLevel)
 
+	balancer, err := proxy.NewBalancer(cfg.Tun.Balancer)
+	if err != nil {
+		return err
+	}
+
+	var createTimeout time.Duration
+	if len(cfg.Tun.CreateTimeout) > 0 {
+		createTimeout, err = time.ParseDuration(cfg.Tun.CreateTimeout)
+		if err != nil {
+			return fmt.Errorf("parse tun create timeout %s failed %s", cfg.Tun.CreateTimeout, err.Error())
+		}
+	}
+
 	tunInfos := []*selector.TunInfo{{URL: cfg.Tun.URL, Auth: cfg.Tun.AuthKey}}
-	tunMgr := proxy.NewTunManager(cfg.Tun.Count, cfg.Tun.Cap, selector.NewFixSelector(tunInfos))
+	opts := []proxy.Option{
+		proxy.WithFlowWindow(cfg.Tun.Window),
+		proxy.WithBalancer(balancer),
+		proxy.WithCreateRetry(cfg.Tun.CreateAttempts, createTimeout),
+	}
+	tunMgr := proxy.NewTunManager(cfg.Tun.Count, cfg.Tun.Cap, selector.NewFixSelector(tunInfos), opts...)
 	tunMgr.Startup()
 
 	go func() {
@@ -0,0 +1,84 @@
+package worker
+
+import (
+	"net/http"
+	"time"
+)
+
+// Handler send a request to the api server, the innermost Handler is the http client
+type Handler func(req *http.Request) (*http.Response, error)
+
+// Middleware wrap the Handler of every request to the api server, including login,
+// e.g. to log, to collect metrics or to add auth headers. A middleware may change
+// the request before calling next, and must return the response of next or an error
+type Middleware func(next Handler) Handler
+
+// WithMiddleware add the middlewares, the first one is the outermost.
+// The requests retried by the retry policy pass the middlewares again
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(o *options) error {
+		o.middlewares = append(o.middlewares, middlewares...)
+		return nil
+	}
+}
+
+// chain wrap handler with middlewares, the first one is the outermost
+func chain(handler Handler, middlewares []Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// LoggingMiddleware log each request with its status and duration at debug level
+func LoggingMiddleware() Middleware {
+	return func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next(req)
+			if err != nil {
+				log.Debugf("%s %s failed after %s: %s", req.Method, req.URL.Path, time.Since(start), err.Error())
+				return resp, err
+			}
+
+			log.Debugf("%s %s %d %s", req.Method, req.URL.Path, resp.StatusCode, time.Since(start))
+			return resp, nil
+		}
+	}
+}
+
+// RequestMetric describe a request to the api server, StatusCode is 0 if Err is not nil
+type RequestMetric struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Duration   time.Duration
+	Err        error
+}
+
+// MetricsMiddleware call observe after each request, observe must be safe for concurrent use
+func MetricsMiddleware(observe func(RequestMetric)) Middleware {
+	return func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next(req)
+
+			metric := RequestMetric{Method: req.Method, Path: req.URL.Path, Duration: time.Since(start), Err: err}
+			if resp != nil {
+				metric.StatusCode = resp.StatusCode
+			}
+			observe(metric)
+			return resp, err
+		}
+	}
+}
+
+// HeaderMiddleware set the header on each request, e.g. the credentials of an auth gateway
+func HeaderMiddleware(key, value string) Middleware {
+	return func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			req.Header.Set(key, value)
+			return next(req)
+		}
+	}
+}
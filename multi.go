@@ -0,0 +1,286 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Account is a Worker of an account of MultiWorker
+type Account struct {
+	// Name tag the projects of the account, it must be unique
+	Name   string
+	Worker Worker
+}
+
+// MultiWorker aggregate the projects of several accounts, which may be on different api servers.
+// GetProjects and LoadProjects fan out to all accounts and merge the results tagged with
+// the name of their account, the failed accounts are returned as AccountErrors along with
+// the projects of the other accounts. The calls of a project are sent to the account of the project,
+// CreateProject to the account of ReqCreateProject.Account, and the regions are listed
+// with the first account. The project ids must be unique across the accounts
+type MultiWorker struct {
+	accounts []Account
+
+	lock sync.Mutex
+	// the account of the projects seen by GetProjects
+	projectAccounts map[string]*Account
+}
+
+// NewMultiWorker returns an error if there is no account or the names are not unique
+func NewMultiWorker(accounts ...Account) (*MultiWorker, error) {
+	if len(accounts) == 0 {
+		return nil, fmt.Errorf("no account")
+	}
+
+	names := make(map[string]bool)
+	for _, account := range accounts {
+		if names[account.Name] {
+			return nil, fmt.Errorf("duplicate account name %s", account.Name)
+		}
+		names[account.Name] = true
+	}
+
+	return &MultiWorker{accounts: accounts, projectAccounts: make(map[string]*Account)}, nil
+}
+
+// Accounts returns the accounts in the order they were added
+func (m *MultiWorker) Accounts() []Account {
+	return append([]Account(nil), m.accounts...)
+}
+
+// account returns the account of the name, the first account if name is empty
+func (m *MultiWorker) account(name string) (*Account, error) {
+	if len(name) == 0 {
+		return &m.accounts[0], nil
+	}
+
+	for i := range m.accounts {
+		if m.accounts[i].Name == name {
+			return &m.accounts[i], nil
+		}
+	}
+	return nil, fmt.Errorf("account %s does not exist", name)
+}
+
+// projectAccount returns the account of the project, if the project has not been
+// seen by GetProjects, ask each account for it
+func (m *MultiWorker) projectAccount(ctx context.Context, projectID string) (*Account, *PorjectInfo, error) {
+	m.lock.Lock()
+	account, ok := m.projectAccounts[projectID]
+	m.lock.Unlock()
+
+	if ok {
+		return account, nil, nil
+	}
+
+	for i := range m.accounts {
+		account := &m.accounts[i]
+		info, err := account.Worker.GetProjectInfoCtx(ctx, projectID)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("account %s: %w", account.Name, err)
+		}
+
+		m.remember(projectID, account)
+		return account, info, nil
+	}
+	return nil, nil, &APIError{Endpoint: "/api/v1/project/info", Code: codeNotFound, Message: fmt.Sprintf("project %s not found in any account", projectID)}
+}
+
+func (m *MultiWorker) remember(projectID string, account *Account) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if old, ok := m.projectAccounts[projectID]; ok && old != account {
+		log.Warnf("project %s exists in account %s and %s, use %s", projectID, old.Name, account.Name, account.Name)
+	}
+	m.projectAccounts[projectID] = account
+}
+
+func (m *MultiWorker) forget(projectID string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.projectAccounts, projectID)
+}
+
+// fanOut call fn for each account concurrently, results[i] and errs[i] are of the i-th account
+func fanOut[T any](m *MultiWorker, fn func(account *Account) (T, error)) ([]T, []error) {
+	results := make([]T, len(m.accounts))
+	errs := make([]error, len(m.accounts))
+
+	var wg sync.WaitGroup
+	for i := range m.accounts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = fn(&m.accounts[i])
+		}(i)
+	}
+	wg.Wait()
+
+	return results, errs
+}
+
+func (m *MultiWorker) UpldateProject(req *ReqUpdatePorjct) error {
+	return m.UpldateProjectCtx(context.Background(), req)
+}
+
+func (m *MultiWorker) UpldateProjectCtx(ctx context.Context, req *ReqUpdatePorjct) error {
+	account, _, err := m.projectAccount(ctx, req.ID)
+	if err != nil {
+		return err
+	}
+	return account.Worker.UpldateProjectCtx(ctx, req)
+}
+
+func (m *MultiWorker) CreateProject(req *ReqCreateProject) error {
+	return m.CreateProjectCtx(context.Background(), req)
+}
+
+func (m *MultiWorker) CreateProjectCtx(ctx context.Context, req *ReqCreateProject) error {
+	account, err := m.account(req.Account)
+	if err != nil {
+		return err
+	}
+	return account.Worker.CreateProjectCtx(ctx, req)
+}
+
+func (m *MultiWorker) GetProjects(page, size int) ([]*Project, error) {
+	return m.GetProjectsCtx(context.Background(), page, size)
+}
+
+// GetProjectsCtx returns the page of each account, so a page has at most size projects of each account.
+// The failed accounts are returned as AccountErrors along with the projects of the other accounts,
+// if all accounts failed their errors are joined and returned without AccountErrors
+func (m *MultiWorker) GetProjectsCtx(ctx context.Context, page, size int) ([]*Project, error) {
+	results, errs := fanOut(m, func(account *Account) ([]*Project, error) {
+		return account.Worker.GetProjectsCtx(ctx, page, size)
+	})
+
+	all := make([]*Project, 0)
+	var accountErrs AccountErrors
+	for i, projects := range results {
+		account := &m.accounts[i]
+		if errs[i] != nil {
+			accountErrs = append(accountErrs, &AccountError{Account: account.Name, Err: errs[i]})
+			continue
+		}
+
+		for _, project := range projects {
+			p := *project
+			p.Account = account.Name
+			m.remember(p.ID, account)
+			all = append(all, &p)
+		}
+	}
+
+	// nothing to return along with the errors
+	if len(accountErrs) == len(m.accounts) {
+		return nil, errors.Join(accountErrs.Unwrap()...)
+	}
+
+	if len(accountErrs) > 0 {
+		return all, accountErrs
+	}
+	return all, nil
+}
+
+func (m *MultiWorker) DeleteProject(projectID string) error {
+	return m.DeleteProjectCtx(context.Background(), projectID)
+}
+
+func (m *MultiWorker) DeleteProjectCtx(ctx context.Context, projectID string) error {
+	account, _, err := m.projectAccount(ctx, projectID)
+	if err != nil {
+		return err
+	}
+
+	if err := account.Worker.DeleteProjectCtx(ctx, projectID); err != nil {
+		return err
+	}
+	m.forget(projectID)
+	return nil
+}
+
+func (m *MultiWorker) GetProjectInfo(projectID string) (*PorjectInfo, error) {
+	return m.GetProjectInfoCtx(context.Background(), projectID)
+}
+
+func (m *MultiWorker) GetProjectInfoCtx(ctx context.Context, projectID string) (*PorjectInfo, error) {
+	account, info, err := m.projectAccount(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	if info == nil {
+		if info, err = account.Worker.GetProjectInfoCtx(ctx, projectID); err != nil {
+			return nil, err
+		}
+	}
+
+	// the info may be shared by a cache
+	taggedInfo := *info
+	taggedInfo.Account = account.Name
+	return &taggedInfo, nil
+}
+
+func (m *MultiWorker) GetRegions(area string) (*AreaList, error) {
+	return m.GetRegionsCtx(context.Background(), area)
+}
+
+func (m *MultiWorker) GetRegionsCtx(ctx context.Context, area string) (*AreaList, error) {
+	return m.accounts[0].Worker.GetRegionsCtx(ctx, area)
+}
+
+func (m *MultiWorker) ListNodesWithRegions(areaID string, region string, page, size int) (*RegionNodeList, error) {
+	return m.ListNodesWithRegionsCtx(context.Background(), areaID, region, page, size)
+}
+
+func (m *MultiWorker) ListNodesWithRegionsCtx(ctx context.Context, areaID string, region string, page, size int) (*RegionNodeList, error) {
+	return m.accounts[0].Worker.ListNodesWithRegionsCtx(ctx, areaID, region, page, size)
+}
+
+func (m *MultiWorker) GetTunnels(projectID string) ([]*Tunnel, error) {
+	return m.GetTunnelsCtx(context.Background(), projectID)
+}
+
+func (m *MultiWorker) GetTunnelsCtx(ctx context.Context, projectID string) ([]*Tunnel, error) {
+	account, _, err := m.projectAccount(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return account.Worker.GetTunnelsCtx(ctx, projectID)
+}
+
+func (m *MultiWorker) LoadProjects(page, size int) ([]*PorjectInfo, error) {
+	return m.LoadProjectsCtx(context.Background(), page, size)
+}
+
+// LoadProjectsCtx returns the projects of the page of each account which have serving nodes,
+// the failed projects of all accounts are returned as ProjectErrors along with the loaded infos,
+// joined with the AccountErrors of the failed accounts
+func (m *MultiWorker) LoadProjectsCtx(ctx context.Context, page, size int) ([]*PorjectInfo, error) {
+	projects, err := m.GetProjectsCtx(ctx, page, size)
+	var accountErrs AccountErrors
+	if err != nil && !errors.As(err, &accountErrs) {
+		return nil, err
+	}
+
+	pInfos := make([]*PorjectInfo, 0)
+	err = loadProjectInfos(ctx, m, projects, concurrencyOf(m), func(pInfo *PorjectInfo) error {
+		pInfos = append(pInfos, pInfo)
+		return nil
+	})
+
+	var projectErrs ProjectErrors
+	if err != nil && !errors.As(err, &projectErrs) {
+		return nil, err
+	}
+
+	return pInfos, partialErrors(accountErrs, projectErrs)
+}
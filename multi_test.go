@@ -0,0 +1,168 @@
+package worker_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	worker "github.com/zscboy/titan-workers-sdk"
+	"github.com/zscboy/titan-workers-sdk/workertest"
+)
+
+func TestMultiWorker(t *testing.T) {
+	s1 := workertest.NewServer()
+	defer s1.Close()
+	s2 := workertest.NewServer()
+	defer s2.Close()
+
+	id1 := addProject(s1, "first", 1)
+	s2.AddProject(&worker.PorjectInfo{ID: "second", Name: "second", Nodes: []*worker.Node{{ID: "e_1", URL: "ws://127.0.0.1", Status: worker.NodeStatusStarted}, {ID: "e_2", URL: "ws://127.0.0.1", Status: worker.NodeStatusStarted}}}, "china")
+	s2.AddProject(&worker.PorjectInfo{ID: "empty", Name: "empty"}, "china")
+
+	m, err := worker.NewMultiWorker(worker.Account{Name: "a1", Worker: newTestWorker(t, s1)}, worker.Account{Name: "a2", Worker: newTestWorker(t, s2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	projects, err := worker.NewProjectIterator(m, 10).All(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accounts := make(map[string]string)
+	for _, project := range projects {
+		accounts[project.Name] = project.Account
+	}
+
+	if len(projects) != 3 || accounts["first"] != "a1" || accounts["second"] != "a2" || accounts["empty"] != "a2" {
+		t.Fatalf("projects %v", accounts)
+	}
+
+	pInfos, err := worker.NewProjectInfoIterator(m, 10).All(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pInfos) != 2 || pInfos[0].Account != "a1" || pInfos[1].Account != "a2" || len(pInfos[1].Nodes) != 2 {
+		t.Fatalf("project infos %+v", pInfos)
+	}
+
+	// a project not seen by GetProjects is looked up in each account
+	m2, _ := worker.NewMultiWorker(worker.Account{Name: "a2", Worker: newTestWorker(t, s2)}, worker.Account{Name: "a1", Worker: newTestWorker(t, s1)})
+	info, err := m2.GetProjectInfo(id1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Name != "first" || info.Account != "a1" {
+		t.Fatalf("project info %+v", info)
+	}
+
+	if _, err := m2.GetProjectInfo("not-exist"); !errors.Is(err, worker.ErrNotFound) {
+		t.Fatalf("error %v, want ErrNotFound", err)
+	}
+
+	if err := m.CreateProject(&worker.ReqCreateProject{ProjectBase: worker.ProjectBase{Name: "created", Replicas: 1}, Account: "a2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if s2.Calls("/api/v1/project/create") != 1 || s1.Calls("/api/v1/project/create") != 0 {
+		t.Fatal("create project with the account a2")
+	}
+}
+
+func TestMultiWorkerPartialFailure(t *testing.T) {
+	s1 := workertest.NewServer()
+	defer s1.Close()
+	s2 := workertest.NewServer()
+	defer s2.Close()
+
+	addProject(s1, "first", 1)
+	addProject(s2, "second", 1)
+
+	m, err := worker.NewMultiWorker(
+		worker.Account{Name: "a1", Worker: newTestWorker(t, s1)},
+		worker.Account{Name: "a2", Worker: newTestWorker(t, s2, worker.WithRetryPolicy(worker.NoRetry()))},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s2.InjectFault("/api/v1/project/list", 2, workertest.Fault{StatusCode: http.StatusInternalServerError})
+
+	projects, err := m.GetProjects(0, 10)
+	var accountErrs worker.AccountErrors
+	if !errors.As(err, &accountErrs) || len(accountErrs) != 1 || accountErrs[0].Account != "a2" {
+		t.Fatalf("error %v, want the AccountErrors of a2", err)
+	}
+
+	if len(projects) != 1 || projects[0].Name != "first" || projects[0].Account != "a1" {
+		t.Fatalf("projects %+v, want the project of a1", projects)
+	}
+
+	pInfos, err := m.LoadProjects(0, 10)
+	if !errors.As(err, &accountErrs) {
+		t.Fatalf("error %v, want AccountErrors", err)
+	}
+
+	if len(pInfos) != 1 || pInfos[0].Name != "first" {
+		t.Fatalf("project infos %+v, want the project of a1", pInfos)
+	}
+
+	// all accounts failed
+	s1.InjectFault("/api/v1/project/list", 1, workertest.Fault{StatusCode: http.StatusBadRequest})
+	s2.InjectFault("/api/v1/project/list", 1, workertest.Fault{StatusCode: http.StatusInternalServerError})
+	if projects, err := m.GetProjects(0, 10); projects != nil || err == nil || worker.IsPartial(err) {
+		t.Fatalf("GetProjects returns %+v, %v, want only the errors of both accounts", projects, err)
+	}
+}
+
+func TestMultiWorkerIteratorPartialFailure(t *testing.T) {
+	s1 := workertest.NewServer()
+	defer s1.Close()
+	s2 := workertest.NewServer()
+	defer s2.Close()
+
+	for i := 0; i < 3; i++ {
+		addProject(s1, fmt.Sprintf("first-%d", i), 1)
+	}
+	addProject(s2, "second", 1)
+
+	m, err := worker.NewMultiWorker(
+		worker.Account{Name: "a1", Worker: newTestWorker(t, s1)},
+		worker.Account{Name: "a2", Worker: newTestWorker(t, s2, worker.WithRetryPolicy(worker.NoRetry()))},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a2 fails on every page
+	s2.InjectFault("/api/v1/project/list", 10, workertest.Fault{StatusCode: http.StatusInternalServerError})
+
+	projects, err := worker.NewProjectIterator(m, 2).All(context.Background())
+	var accountErrs worker.AccountErrors
+	if !errors.As(err, &accountErrs) || !worker.IsPartial(err) || accountErrs[0].Account != "a2" {
+		t.Fatalf("error %v, want the AccountErrors of a2", err)
+	}
+
+	if len(projects) != 3 {
+		t.Fatalf("%d projects, want the 3 projects of a1", len(projects))
+	}
+
+	pInfos, err := worker.NewProjectInfoIterator(m, 2).All(context.Background())
+	if !errors.As(err, &accountErrs) {
+		t.Fatalf("error %v, want AccountErrors", err)
+	}
+
+	if len(pInfos) != 3 {
+		t.Fatalf("%d project infos, want the 3 projects of a1", len(pInfos))
+	}
+
+	// all accounts failed, nothing is returned
+	s1.InjectFault("/api/v1/project/list", 1, workertest.Fault{StatusCode: http.StatusBadRequest})
+	if projects, err := worker.NewProjectIterator(m, 2).All(context.Background()); projects != nil || err == nil || worker.IsPartial(err) {
+		t.Fatalf("All returns %d projects, %v, want only the error", len(projects), err)
+	}
+}
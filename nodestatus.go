@@ -0,0 +1,118 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// NodeStatus is the status of a node of a project
+type NodeStatus int
+
+const (
+	NodeStatusStarting NodeStatus = 0
+	NodeStatusStarted  NodeStatus = 1
+	NodeStatusFailed   NodeStatus = 2
+	NodeStatusOffline  NodeStatus = 3
+)
+
+var nodeStatusNames = map[NodeStatus]string{
+	NodeStatusStarting: "starting",
+	NodeStatusStarted:  "started",
+	NodeStatusFailed:   "failed",
+	NodeStatusOffline:  "offline",
+}
+
+// ParseNodeStatus parse the name of a status like "started", or its number
+func ParseNodeStatus(s string) (NodeStatus, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for status, name := range nodeStatusNames {
+		if name == s {
+			return status, nil
+		}
+	}
+
+	var n int
+	if _, err := fmt.Sscanf(s, "%d", &n); err == nil && fmt.Sprint(n) == s {
+		return NodeStatus(n), nil
+	}
+	return 0, fmt.Errorf("invalid node status %s", s)
+}
+
+func (s NodeStatus) String() string {
+	if name, ok := nodeStatusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", int(s))
+}
+
+// MarshalText encode the status as its name, an unknown status as its number
+func (s NodeStatus) MarshalText() ([]byte, error) {
+	if name, ok := nodeStatusNames[s]; ok {
+		return []byte(name), nil
+	}
+	return []byte(fmt.Sprint(int(s))), nil
+}
+
+func (s *NodeStatus) UnmarshalText(text []byte) error {
+	status, err := ParseNodeStatus(string(text))
+	if err != nil {
+		return err
+	}
+	*s = status
+	return nil
+}
+
+// UnmarshalJSON accept the number of the api or the name encoded by MarshalText
+func (s *NodeStatus) UnmarshalJSON(data []byte) error {
+	var n int
+	if err := json.Unmarshal(data, &n); err == nil {
+		*s = NodeStatus(n)
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("invalid node status %s", string(data))
+	}
+	return s.UnmarshalText([]byte(text))
+}
+
+// Serving returns true if the node is started and has a websocket url
+func (n *Node) Serving() bool {
+	return n.Status == NodeStatusStarted && len(n.URL) > 0
+}
+
+// NodesWithStatus returns the nodes whose status is one of statuses
+func (info *PorjectInfo) NodesWithStatus(statuses ...NodeStatus) []*Node {
+	nodes := make([]*Node, 0)
+	for _, node := range info.Nodes {
+		for _, status := range statuses {
+			if node.Status == status {
+				nodes = append(nodes, node)
+				break
+			}
+		}
+	}
+	return nodes
+}
+
+// ServingNodes returns the nodes which are started and have a websocket url
+func (info *PorjectInfo) ServingNodes() []*Node {
+	nodes := make([]*Node, 0)
+	for _, node := range info.Nodes {
+		if node.Serving() {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// CountByStatus returns the count of nodes of each status
+func (info *PorjectInfo) CountByStatus() map[NodeStatus]int {
+	counts := make(map[NodeStatus]int)
+	for _, node := range info.Nodes {
+		counts[node.Status]++
+	}
+	return counts
+}
@@ -0,0 +1,60 @@
+package worker_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	worker "github.com/zscboy/titan-workers-sdk"
+)
+
+func TestNodeStatusJSON(t *testing.T) {
+	buf, err := json.Marshal(&worker.Node{ID: "e_1", Status: worker.NodeStatusFailed})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node := &worker.Node{}
+	if err := json.Unmarshal(buf, node); err != nil {
+		t.Fatal(err)
+	}
+
+	if node.Status != worker.NodeStatusFailed {
+		t.Fatalf("status %s, want failed", node.Status)
+	}
+
+	for data, want := range map[string]worker.NodeStatus{`{"status":1}`: worker.NodeStatusStarted, `{"status":"offline"}`: worker.NodeStatusOffline, `{"status":7}`: 7} {
+		node := &worker.Node{}
+		if err := json.Unmarshal([]byte(data), node); err != nil {
+			t.Fatal(err)
+		}
+
+		if node.Status != want {
+			t.Fatalf("unmarshal %s status %s, want %s", data, node.Status, want)
+		}
+	}
+
+	if err := json.Unmarshal([]byte(`{"status":"stopped"}`), &worker.Node{}); err == nil {
+		t.Fatal("unmarshal an unknown status name should fail")
+	}
+}
+
+func TestProjectInfoNodes(t *testing.T) {
+	info := &worker.PorjectInfo{Nodes: []*worker.Node{
+		{ID: "e_1", Status: worker.NodeStatusStarted, URL: "ws://127.0.0.1"},
+		{ID: "e_2", Status: worker.NodeStatusStarted},
+		{ID: "e_3", Status: worker.NodeStatusFailed},
+		{ID: "e_4", Status: worker.NodeStatusOffline},
+	}}
+
+	if nodes := info.ServingNodes(); len(nodes) != 1 || nodes[0].ID != "e_1" {
+		t.Fatalf("serving nodes %v", nodes)
+	}
+
+	if nodes := info.NodesWithStatus(worker.NodeStatusFailed, worker.NodeStatusOffline); len(nodes) != 2 {
+		t.Fatalf("failed or offline nodes %v", nodes)
+	}
+
+	if counts := info.CountByStatus(); counts[worker.NodeStatusStarted] != 2 || counts[worker.NodeStatusStarting] != 0 {
+		t.Fatalf("counts %v", counts)
+	}
+}
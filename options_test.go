@@ -0,0 +1,117 @@
+package worker_test
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	worker "github.com/zscboy/titan-workers-sdk"
+	"github.com/zscboy/titan-workers-sdk/workertest"
+)
+
+// forwardTo returns a server which forward the requests to the url, counted by forwarded
+func forwardTo(t *testing.T, target string, tls bool, forwarded *int32) *httptest.Server {
+	t.Helper()
+
+	u, err := url.Parse(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(u)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(forwarded, 1)
+		proxy.ServeHTTP(w, r)
+	})
+
+	var srv *httptest.Server
+	if tls {
+		srv = httptest.NewTLSServer(handler)
+	} else {
+		srv = httptest.NewServer(handler)
+	}
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOptions(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	var proxied, tlsForwarded int32
+	proxy := forwardTo(t, s.URL, false, &proxied)
+	tlsServer := forwardTo(t, s.URL, true, &tlsForwarded)
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw})
+
+	invalidCAFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(invalidCAFile, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts []worker.Option
+		// tls login to the tls server, which trust only caPEM
+		tls bool
+		// err is the substring of the error of NewWorker, empty if it succeeds
+		err string
+		// proxied is the count of requests expected to go through the proxy
+		proxied int32
+	}{
+		{name: "default"},
+		{name: "http client with timeout", opts: []worker.Option{worker.WithHTTPClient(&http.Client{}), worker.WithTimeout(time.Second)}},
+		{name: "http client with proxy", opts: []worker.Option{worker.WithHTTPClient(&http.Client{}), worker.WithProxy(proxy.URL)},
+			err: "WithHTTPClient can not be combined"},
+		{name: "http client with ca", opts: []worker.Option{worker.WithHTTPClient(&http.Client{}), worker.WithCACert(caPEM)},
+			err: "WithHTTPClient can not be combined"},
+		{name: "http client with transport", opts: []worker.Option{worker.WithHTTPClient(&http.Client{}), worker.WithTransport(http.DefaultTransport)},
+			err: "WithHTTPClient can not be combined"},
+		{name: "transport with proxy", opts: []worker.Option{worker.WithTransport(http.DefaultTransport), worker.WithProxy(proxy.URL)},
+			err: "WithTransport can not be combined"},
+		{name: "nil http client", opts: []worker.Option{worker.WithHTTPClient(nil)}, err: "can not be nil"},
+		{name: "negative timeout", opts: []worker.Option{worker.WithTimeout(-time.Second)}, err: "negative"},
+		{name: "invalid ca", opts: []worker.Option{worker.WithCACert([]byte("not a certificate"))}, err: "no certificate found"},
+		{name: "invalid ca file", opts: []worker.Option{worker.WithCACertFile(invalidCAFile)}, err: "no certificate found"},
+		{name: "missing ca file", opts: []worker.Option{worker.WithCACertFile(invalidCAFile + ".none")}, err: "read CA bundle"},
+		{name: "invalid proxy", opts: []worker.Option{worker.WithProxy("://proxy")}, err: "parse proxy url"},
+		{name: "proxy", opts: []worker.Option{worker.WithProxy(proxy.URL)}, proxied: 1},
+		{name: "ca", opts: []worker.Option{worker.WithCACert(caPEM)}, tls: true},
+		{name: "tls without ca", tls: true, err: "certificate"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := s.Config()
+			if test.tls {
+				cfg.APIServer = tlsServer.URL
+			}
+
+			atomic.StoreInt32(&proxied, 0)
+			opts := append([]worker.Option{worker.WithRetryPolicy(worker.NoRetry())}, test.opts...)
+			_, err := worker.NewWorker(cfg, opts...)
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, expect %q", err, test.err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("NewWorker %s", err.Error())
+			}
+
+			// the login went through the proxy
+			if got := atomic.LoadInt32(&proxied); got != test.proxied {
+				t.Fatalf("%d requests through the proxy, expect %d", got, test.proxied)
+			}
+		})
+	}
+}
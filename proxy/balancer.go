@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	BalancerRoundRobin       = "round-robin"
+	BalancerLeastActive      = "least-active"
+	BalancerLatencyWeighted  = "latency-weighted"
+	BalancerRandomTwoChoices = "random-two-choices"
+)
+
+// defaultLatency is the latency of a tunnel which has no pong yet
+const defaultLatency = 200 * time.Millisecond
+
+// Balancer pick the tunnel of a new request
+type Balancer interface {
+	// Pick returns one of tunnels, which are connected and not full.
+	// It's called with the lock of the pool held, and tunnels is not empty
+	Pick(tunnels []*Tunnel) *Tunnel
+}
+
+// NewBalancer returns the built-in balancer of the name, round-robin if name is empty
+func NewBalancer(name string) (Balancer, error) {
+	switch name {
+	case "", BalancerRoundRobin:
+		return &roundRobinBalancer{}, nil
+	case BalancerLeastActive:
+		return leastActiveBalancer{}, nil
+	case BalancerLatencyWeighted:
+		return latencyWeightedBalancer{}, nil
+	case BalancerRandomTwoChoices:
+		return randomTwoChoicesBalancer{}, nil
+	}
+	return nil, fmt.Errorf("unknown balancer %s", name)
+}
+
+// roundRobinBalancer pick the tunnels in turn
+type roundRobinBalancer struct {
+	next uint64
+}
+
+func (b *roundRobinBalancer) Pick(tunnels []*Tunnel) *Tunnel {
+	n := atomic.AddUint64(&b.next, 1) - 1
+	return tunnels[n%uint64(len(tunnels))]
+}
+
+// leastActiveBalancer pick the tunnel with the fewest requests, the first one of a tie
+type leastActiveBalancer struct{}
+
+func (leastActiveBalancer) Pick(tunnels []*Tunnel) *Tunnel {
+	picked := tunnels[0]
+	for _, tun := range tunnels[1:] {
+		if tun.ActiveRequests() < picked.ActiveRequests() {
+			picked = tun
+		}
+	}
+	return picked
+}
+
+// latencyWeightedBalancer pick a tunnel at random, weighted by the inverse of its latency
+type latencyWeightedBalancer struct{}
+
+func (latencyWeightedBalancer) Pick(tunnels []*Tunnel) *Tunnel {
+	weights := make([]float64, len(tunnels))
+	total := 0.0
+	for i, tun := range tunnels {
+		latency := tun.Latency()
+		if latency <= 0 {
+			latency = defaultLatency
+		}
+		weights[i] = 1 / float64(latency)
+		total += weights[i]
+	}
+
+	r := rand.Float64() * total
+	for i, weight := range weights {
+		if r < weight {
+			return tunnels[i]
+		}
+		r -= weight
+	}
+	return tunnels[len(tunnels)-1]
+}
+
+// randomTwoChoicesBalancer pick two tunnels at random, and take the one with fewer requests
+type randomTwoChoicesBalancer struct{}
+
+func (randomTwoChoicesBalancer) Pick(tunnels []*Tunnel) *Tunnel {
+	if len(tunnels) == 1 {
+		return tunnels[0]
+	}
+
+	i := rand.Intn(len(tunnels))
+	j := rand.Intn(len(tunnels) - 1)
+	if j >= i {
+		j++
+	}
+
+	if tunnels[j].ActiveRequests() < tunnels[i].ActiveRequests() {
+		return tunnels[j]
+	}
+	return tunnels[i]
+}
@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestTunnel returns a connected tunnel with active requests
+func newTestTunnel(nodeID string, cap, active int) *Tunnel {
+	tun := &Tunnel{targetNodeID: nodeID, reqq: newReqq(cap, 0), conn: &websocket.Conn{}, latency: newLatencyStats()}
+	for i := 0; i < active; i++ {
+		tun.reqq.allocReq(nil)
+	}
+	return tun
+}
+
+func pickCounts(b Balancer, tunnels []*Tunnel, n int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		counts[b.Pick(tunnels).NodeID()]++
+	}
+	return counts
+}
+
+func TestNewBalancer(t *testing.T) {
+	for _, name := range []string{"", BalancerRoundRobin, BalancerLeastActive, BalancerLatencyWeighted, BalancerRandomTwoChoices} {
+		if _, err := NewBalancer(name); err != nil {
+			t.Fatalf("%q: %s", name, err.Error())
+		}
+	}
+
+	if _, err := NewBalancer("fastest"); err == nil {
+		t.Fatal("expect error of unknown balancer")
+	}
+}
+
+func TestRoundRobinBalancer(t *testing.T) {
+	tunnels := []*Tunnel{newTestTunnel("a", 10, 0), newTestTunnel("b", 10, 0), newTestTunnel("c", 10, 0)}
+	b, _ := NewBalancer(BalancerRoundRobin)
+
+	for i := 0; i < 6; i++ {
+		if got, expect := b.Pick(tunnels), tunnels[i%3]; got != expect {
+			t.Fatalf("pick %d got %s, expect %s", i, got.NodeID(), expect.NodeID())
+		}
+	}
+}
+
+func TestLeastActiveBalancer(t *testing.T) {
+	tunnels := []*Tunnel{newTestTunnel("a", 10, 3), newTestTunnel("b", 10, 1), newTestTunnel("c", 10, 2)}
+	b, _ := NewBalancer(BalancerLeastActive)
+
+	if got := b.Pick(tunnels).NodeID(); got != "b" {
+		t.Fatalf("got %s, expect b", got)
+	}
+}
+
+func TestLatencyWeightedBalancer(t *testing.T) {
+	fast, slow := newTestTunnel("fast", 10, 0), newTestTunnel("slow", 10, 0)
+	fast.latency.add(10 * time.Millisecond)
+	slow.latency.add(90 * time.Millisecond)
+	b, _ := NewBalancer(BalancerLatencyWeighted)
+
+	counts := pickCounts(b, []*Tunnel{fast, slow}, 1000)
+	// the fast tunnel is expected to take 90% of the requests
+	if counts["fast"] < 800 || counts["slow"] == 0 {
+		t.Fatalf("unexpected picks %v", counts)
+	}
+
+	if fast.Latency() != 10*time.Millisecond {
+		t.Fatalf("latency %s", fast.Latency())
+	}
+}
+
+func TestRandomTwoChoicesBalancer(t *testing.T) {
+	busy, idle := newTestTunnel("busy", 10, 5), newTestTunnel("idle", 10, 0)
+	b, _ := NewBalancer(BalancerRandomTwoChoices)
+
+	// with two tunnels both are compared each time
+	counts := pickCounts(b, []*Tunnel{busy, idle}, 100)
+	if counts["idle"] != 100 {
+		t.Fatalf("unexpected picks %v", counts)
+	}
+
+	if got := b.Pick([]*Tunnel{busy}); got != busy {
+		t.Fatal("expect the only tunnel")
+	}
+}
+
+func TestAllocTunnelSkipIneligible(t *testing.T) {
+	disconnected := newTestTunnel("disconnected", 10, 0)
+	disconnected.conn = nil
+	full := newTestTunnel("full", 2, 2)
+	ok := newTestTunnel("ok", 10, 5)
+
+	tp := &TunPool{tm: &TunMgr{opts: defaultOptions()}}
+	if tp.allocTunnelForRequest(nil) != nil {
+		t.Fatal("expect nil without tunnel")
+	}
+
+	tp.tunnels = []*Tunnel{disconnected, full}
+	if tp.allocTunnelForRequest(nil) != nil {
+		t.Fatal("expect nil without eligible tunnel")
+	}
+
+	tp.tunnels = []*Tunnel{disconnected, full, ok}
+	for i := 0; i < 3; i++ {
+		if got := tp.allocTunnelForRequest(nil); got != ok {
+			t.Fatalf("got %v, expect the eligible tunnel", got)
+		}
+	}
+}
+
+func activeRequests(tunnels []*Tunnel) []int {
+	counts := make([]int, 0, len(tunnels))
+	for _, tun := range tunnels {
+		counts = append(counts, tun.ActiveRequests())
+	}
+	return counts
+}
+
+func TestBalancerSpreadRequests(t *testing.T) {
+	s1, s2 := newRefServer(t), newRefServer(t)
+	tm := newTestTunMgr(t, []string{s1.URL, s2.URL}, WithBalancer(leastActiveBalancer{}))
+	waitFor(t, 5*time.Second, func() bool {
+		tunnels := tm.tunPool.getTunnels()
+		return len(tunnels) == 2 && tunnels[0].isConnected() && tunnels[1].isConnected()
+	})
+
+	for i := 1; i <= 2; i++ {
+		client, local := connPair(t)
+		defer client.Close()
+		go tm.OnAcceptRequest(local, &DestAddr{Addr: "example.com", Port: 80})
+
+		waitFor(t, 5*time.Second, func() bool {
+			counts := activeRequests(tm.tunPool.getTunnels())
+			return counts[0]+counts[1] == i
+		})
+	}
+
+	// the second request goes to the tunnel without request
+	if counts := activeRequests(tm.tunPool.getTunnels()); counts[0] != 1 || counts[1] != 1 {
+		t.Fatalf("unexpected active requests %v", counts)
+	}
+}
@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBackoffBase = time.Second
+	defaultBackoffMax  = time.Minute
+	// breakerThreshold is the count of consecutive failures which open the circuit of a node
+	breakerThreshold = 3
+	// stableAfter is how long a connection must last to forget the failures of its node,
+	// so a flapping node keep backing off
+	stableAfter = 30 * time.Second
+	// maxReconnectFailures is the count of consecutive failures after which a broken tunnel
+	// is dropped from the pool, so refresh can replace it by another node
+	maxReconnectFailures = 10
+)
+
+type breakerState int
+
+const (
+	// breakerClosed the node is healthy, or failed less than breakerThreshold times
+	breakerClosed breakerState = iota
+	// breakerOpen the node is not dialed until its backoff elapse
+	breakerOpen
+	// breakerHalfOpen a single dial is probing the node
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerClosed:
+		return "closed"
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// backoff is an exponential backoff with jitter
+type backoff struct {
+	base time.Duration
+	max  time.Duration
+}
+
+// delay returns the wait after failures consecutive failures, it's a random duration
+// between the half and the whole of base*2^(failures-1), capped at max
+func (b backoff) delay(failures int) time.Duration {
+	d := b.base
+	for i := 1; i < failures && d < b.max; i++ {
+		d *= 2
+	}
+	if d > b.max {
+		d = b.max
+	}
+
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// breaker is the circuit breaker of a node
+type breaker struct {
+	state    breakerState
+	failures int
+	// retryAt is the earliest time to dial the node again
+	retryAt time.Time
+	// connectedAt is the time of the last successful dial
+	connectedAt time.Time
+}
+
+// breakers track the dials of each node by targetNodeID
+type breakers struct {
+	lock    sync.Mutex
+	nodes   map[string]*breaker
+	backoff backoff
+}
+
+func newBreakers(b backoff) *breakers {
+	return &breakers{nodes: make(map[string]*breaker), backoff: b}
+}
+
+func (bs *breakers) get(nodeID string) *breaker {
+	b, ok := bs.nodes[nodeID]
+	if !ok {
+		b = &breaker{}
+		bs.nodes[nodeID] = b
+	}
+	return b
+}
+
+func (bs *breakers) transition(nodeID string, b *breaker, state breakerState) {
+	if b.state == state {
+		return
+	}
+
+	if state == breakerOpen {
+		log.Warnf("[TunPool] node %s circuit %s -> %s after %d failures, retry in %s", nodeID, b.state, state, b.failures, time.Until(b.retryAt).Round(time.Millisecond))
+	} else {
+		log.Infof("[TunPool] node %s circuit %s -> %s", nodeID, b.state, state)
+	}
+	b.state = state
+}
+
+// allow reports whether the node can be dialed now, an open circuit
+// whose backoff elapsed turns half-open and allow a single dial
+func (bs *breakers) allow(nodeID string, now time.Time) bool {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+
+	b := bs.get(nodeID)
+	if now.Before(b.retryAt) {
+		return false
+	}
+
+	switch b.state {
+	case breakerOpen:
+		bs.transition(nodeID, b, breakerHalfOpen)
+		return true
+	case breakerHalfOpen:
+		return false
+	}
+	return true
+}
+
+// retryAfter returns how long to wait before the node can be dialed
+func (bs *breakers) retryAfter(nodeID string, now time.Time) time.Duration {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+
+	if wait := bs.get(nodeID).retryAt.Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// onSuccess close the circuit of the node, its failures are forgotten
+// once the connection is stable
+func (bs *breakers) onSuccess(nodeID string, now time.Time) {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+
+	b := bs.get(nodeID)
+	b.retryAt = time.Time{}
+	b.connectedAt = now
+	bs.transition(nodeID, b, breakerClosed)
+}
+
+// onFailure record a failure of the node and returns the count of consecutive failures
+func (bs *breakers) onFailure(nodeID string, now time.Time) int {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+
+	b := bs.get(nodeID)
+	if b.state == breakerClosed && !b.connectedAt.IsZero() && now.Sub(b.connectedAt) >= stableAfter {
+		b.failures = 0
+	}
+	b.connectedAt = time.Time{}
+
+	b.failures++
+	b.retryAt = now.Add(bs.backoff.delay(b.failures))
+
+	// a failed probe opens the circuit again
+	if b.state == breakerHalfOpen || b.failures >= breakerThreshold {
+		bs.transition(nodeID, b, breakerOpen)
+	}
+	return b.failures
+}
+
+func (bs *breakers) state(nodeID string) breakerState {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+
+	return bs.get(nodeID).state
+}
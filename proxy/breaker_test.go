@@ -0,0 +1,162 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zscboy/titan-workers-sdk/selector"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := backoff{base: 100 * time.Millisecond, max: time.Second}
+	for failures, expect := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 5: time.Second, 30: time.Second} {
+		for i := 0; i < 20; i++ {
+			if d := b.delay(failures); d < expect/2 || d > expect {
+				t.Fatalf("delay of %d failures %s, expect in [%s, %s]", failures, d, expect/2, expect)
+			}
+		}
+	}
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	bs := newBreakers(backoff{base: time.Second, max: time.Minute})
+	now := time.Now()
+
+	if !bs.allow("a", now) || bs.state("a") != breakerClosed {
+		t.Fatal("a new node is allowed")
+	}
+
+	for i := 1; i < breakerThreshold; i++ {
+		bs.onFailure("a", now)
+	}
+	if bs.state("a") != breakerClosed {
+		t.Fatalf("circuit %s before threshold", bs.state("a"))
+	}
+	if bs.allow("a", now) {
+		t.Fatal("expect backoff after failure")
+	}
+
+	now = now.Add(time.Hour)
+	bs.onFailure("a", now)
+	if bs.state("a") != breakerOpen {
+		t.Fatalf("circuit %s at threshold", bs.state("a"))
+	}
+	if bs.allow("a", now) || bs.retryAfter("a", now) <= 0 {
+		t.Fatal("expect open circuit to wait")
+	}
+
+	// a single probe after the backoff
+	now = now.Add(time.Hour)
+	if !bs.allow("a", now) || bs.state("a") != breakerHalfOpen {
+		t.Fatal("expect half-open after backoff")
+	}
+	if bs.allow("a", now) {
+		t.Fatal("half-open allow a single probe")
+	}
+
+	// a failed probe opens again, with a longer backoff
+	bs.onFailure("a", now)
+	if bs.state("a") != breakerOpen || bs.retryAfter("a", now) < 4*time.Second {
+		t.Fatalf("circuit %s retry after %s", bs.state("a"), bs.retryAfter("a", now))
+	}
+
+	now = now.Add(time.Hour)
+	bs.allow("a", now)
+	bs.onSuccess("a", now)
+	if bs.state("a") != breakerClosed || !bs.allow("a", now) {
+		t.Fatal("expect closed after success")
+	}
+}
+
+func TestBreakerFlapping(t *testing.T) {
+	bs := newBreakers(backoff{base: time.Second, max: time.Minute})
+	now := time.Now()
+
+	// the failures of a node whose connections do not last are kept
+	for i := 0; i < breakerThreshold; i++ {
+		bs.onSuccess("a", now)
+		now = now.Add(time.Second)
+		bs.onFailure("a", now)
+		now = now.Add(time.Hour)
+		bs.allow("a", now)
+	}
+	if bs.state("a") != breakerHalfOpen {
+		t.Fatalf("circuit %s of flapping node", bs.state("a"))
+	}
+
+	// a stable connection forget them
+	bs.onSuccess("a", now)
+	now = now.Add(stableAfter)
+	if failures := bs.onFailure("a", now); failures != 1 {
+		t.Fatalf("failures %d after stable connection", failures)
+	}
+}
+
+func TestTunnelReconnect(t *testing.T) {
+	s := newRefServer(t)
+	tm := newTestTunMgr(t, []string{s.URL}, WithReconnectBackoff(10*time.Millisecond, 40*time.Millisecond))
+	tun := tm.tunPool.getTunnels()[0]
+	waitFor(t, 5*time.Second, func() bool { return s.connectCount() == 1 })
+
+	s.dropConns()
+	waitFor(t, 5*time.Second, func() bool { return s.connectCount() == 2 && tun.isConnected() })
+
+	// the tunnel keep its identity
+	if tunnels := tm.tunPool.getTunnels(); len(tunnels) != 1 || tunnels[0] != tun {
+		t.Fatal("expect the same tunnel in the pool")
+	}
+
+	s.lock.Lock()
+	uuid := s.query["uuid"]
+	s.lock.Unlock()
+	if uuid != tun.uuid {
+		t.Fatalf("reconnect with uuid %s, expect %s", uuid, tun.uuid)
+	}
+
+	if got := echo(t, tm, []byte("hello")); string(got) != "hello" {
+		t.Fatalf("echo %q", got)
+	}
+}
+
+func TestTunnelReconnectBackoff(t *testing.T) {
+	s := newRefServer(t)
+	tm := newTestTunMgr(t, []string{s.URL}, WithReconnectBackoff(10*time.Millisecond, 40*time.Millisecond))
+	tun := tm.tunPool.getTunnels()[0]
+
+	s.setReject(true)
+	s.dropConns()
+	waitFor(t, 5*time.Second, func() bool { return tm.tunPool.breakers.state("a") == breakerOpen })
+
+	if tun.isConnected() || tm.allocTunnelForRequest() != nil {
+		t.Fatal("expect the broken tunnel skipped")
+	}
+
+	s.setReject(false)
+	waitFor(t, 5*time.Second, func() bool { return tun.isConnected() })
+	if state := tm.tunPool.breakers.state("a"); state != breakerClosed {
+		t.Fatalf("circuit %s after reconnect", state)
+	}
+}
+
+func TestTunnelBrokenBeforeAdd(t *testing.T) {
+	s := newRefServer(t)
+	tm := newTestTunMgr(t, []string{s.URL}, WithReconnectBackoff(10*time.Millisecond, 40*time.Millisecond))
+	tp := tm.tunPool
+	tp.rmeoveTunnel(tp.getTunnels()[0])
+
+	tun, err := tp.dial(&selector.TunInfo{NodeID: "a", URL: s.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the websocket breaks before the tunnel is in the pool
+	s.dropConns()
+	if !tp.add(tun) {
+		t.Fatal("expect the tunnel added")
+	}
+
+	waitFor(t, 5*time.Second, func() bool { return s.connectCount() == 3 && tun.isConnected() })
+	if tunnels := tp.getTunnels(); len(tunnels) != 1 || tunnels[0] != tun {
+		t.Fatal("expect the reconnected tunnel in the pool")
+	}
+}
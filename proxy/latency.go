@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// maxLatencySamples is the count of recent round trips kept for the percentiles
+	maxLatencySamples = 32
+	// ewmaWeight is the weight of a new round trip in the moving average
+	ewmaWeight = 0.2
+	// jitterWeight is the gain of the jitter estimator of RFC 3550
+	jitterWeight = 1.0 / 16
+)
+
+// monoStart is the base of the ping timestamps, time.Since use the monotonic clock
+var monoStart = time.Now()
+
+// monoNow returns the nanoseconds since monoStart, it never goes backwards
+func monoNow() uint64 {
+	return uint64(time.Since(monoStart))
+}
+
+// LatencyStats is the round trip time of the pings of a tunnel
+type LatencyStats struct {
+	// Samples is the count of pongs received
+	Samples int
+	Last    time.Duration
+	// EWMA is the exponentially weighted moving average of the round trips
+	EWMA time.Duration
+	// P50 and P95 are the percentiles of the recent round trips
+	P50 time.Duration
+	P95 time.Duration
+	// Jitter is the smoothed variation between two consecutive round trips
+	Jitter time.Duration
+}
+
+// TunnelStats is a snapshot of a tunnel returned by TunMgr.Stats
+type TunnelStats struct {
+	NodeID         string
+	URL            string
+	Connected      bool
+	ActiveRequests int
+	LastPong       time.Time
+	Latency        LatencyStats
+}
+
+// latencyStats collect the round trips of a tunnel, it's updated by the read goroutine
+// of the tunnel and read by the pool and the balancer
+type latencyStats struct {
+	lock     sync.Mutex
+	count    int
+	last     time.Duration
+	ewma     float64
+	jitter   float64
+	samples  []time.Duration
+	next     int
+	lastPong time.Time
+}
+
+func newLatencyStats() *latencyStats {
+	return &latencyStats{samples: make([]time.Duration, 0, maxLatencySamples), lastPong: time.Now()}
+}
+
+func (s *latencyStats) add(rtt time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.count == 0 {
+		s.ewma = float64(rtt)
+	} else {
+		s.ewma += ewmaWeight * (float64(rtt) - s.ewma)
+
+		diff := float64(rtt - s.last)
+		if diff < 0 {
+			diff = -diff
+		}
+		s.jitter += jitterWeight * (diff - s.jitter)
+	}
+
+	if len(s.samples) < maxLatencySamples {
+		s.samples = append(s.samples, rtt)
+	} else {
+		s.samples[s.next] = rtt
+		s.next = (s.next + 1) % maxLatencySamples
+	}
+
+	s.count++
+	s.last = rtt
+	s.lastPong = time.Now()
+}
+
+// average returns the moving average, 0 if there is no sample yet
+func (s *latencyStats) average() time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return time.Duration(s.ewma)
+}
+
+// touch restart the pong timeout, e.g. after a reconnect
+func (s *latencyStats) touch() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.lastPong = time.Now()
+}
+
+func (s *latencyStats) lastPongTime() time.Time {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.lastPong
+}
+
+func (s *latencyStats) snapshot() LatencyStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stats := LatencyStats{Samples: s.count, Last: s.last, EWMA: time.Duration(s.ewma), Jitter: time.Duration(s.jitter)}
+	if len(s.samples) > 0 {
+		sorted := append([]time.Duration(nil), s.samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		stats.P50 = percentile(sorted, 50)
+		stats.P95 = percentile(sorted, 95)
+	}
+	return stats
+}
+
+// percentile returns the nearest-rank percentile p of sorted, which is not empty
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyStats(t *testing.T) {
+	s := newLatencyStats()
+	if stats := s.snapshot(); stats.Samples != 0 || stats.EWMA != 0 || stats.P95 != 0 {
+		t.Fatalf("unexpected empty stats %+v", stats)
+	}
+
+	s.add(100 * time.Millisecond)
+	if stats := s.snapshot(); stats.EWMA != 100*time.Millisecond || stats.Jitter != 0 {
+		t.Fatalf("the first sample is the average %+v", stats)
+	}
+
+	s.add(200 * time.Millisecond)
+	stats := s.snapshot()
+	if stats.EWMA != 120*time.Millisecond {
+		t.Fatalf("ewma %s", stats.EWMA)
+	}
+	if stats.Jitter != 100*time.Millisecond/16 {
+		t.Fatalf("jitter %s", stats.Jitter)
+	}
+	if stats.Last != 200*time.Millisecond || stats.Samples != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestLatencyPercentiles(t *testing.T) {
+	s := newLatencyStats()
+	// the oldest samples are dropped
+	for i := 0; i < maxLatencySamples; i++ {
+		s.add(time.Hour)
+	}
+	for i := 1; i <= maxLatencySamples; i++ {
+		s.add(time.Duration(i) * time.Millisecond)
+	}
+
+	stats := s.snapshot()
+	if stats.P50 != 16*time.Millisecond || stats.P95 != 31*time.Millisecond {
+		t.Fatalf("p50 %s p95 %s", stats.P50, stats.P95)
+	}
+	if stats.Samples != 2*maxLatencySamples {
+		t.Fatalf("samples %d", stats.Samples)
+	}
+}
+
+func TestSortByLatency(t *testing.T) {
+	none, slow, fast := newTestTunnel("none", 10, 0), newTestTunnel("slow", 10, 0), newTestTunnel("fast", 10, 0)
+	slow.latency.add(50 * time.Millisecond)
+	fast.latency.add(5 * time.Millisecond)
+
+	tunnels := []*Tunnel{none, slow, fast}
+	sortByLatency(tunnels)
+	if tunnels[0] != fast || tunnels[1] != slow || tunnels[2] != none {
+		t.Fatalf("unexpected order %s %s %s", tunnels[0].NodeID(), tunnels[1].NodeID(), tunnels[2].NodeID())
+	}
+}
+
+func TestPingLatency(t *testing.T) {
+	s := newRefServer(t)
+	tm := newTestTunMgr(t, []string{s.URL})
+	waitFor(t, 5*time.Second, func() bool { return tm.tunPool.getTunnels()[0].isConnected() })
+
+	before := time.Now()
+	if err := tm.tunPool.getTunnels()[0].sendPing(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 5*time.Second, func() bool { return tm.Stats()[0].Latency.Samples > 0 })
+	elapsed := time.Since(before)
+
+	stats := tm.Stats()
+	if len(stats) != 1 || stats[0].NodeID != "a" || !stats[0].Connected {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	rtt := stats[0].Latency.Last
+	if rtt <= 0 || rtt > elapsed {
+		t.Fatalf("rtt %s, elapsed %s", rtt, elapsed)
+	}
+	if stats[0].LastPong.Before(before) {
+		t.Fatal("last pong is not updated")
+	}
+}
@@ -0,0 +1,78 @@
+package proxy
+
+import "time"
+
+const (
+	defaultCreateAttempts = 3
+	defaultCreateTimeout  = 5 * time.Second
+)
+
+// Option customize the TunMgr, pass them to NewTunManager
+type Option func(*options)
+
+type options struct {
+	// window is the initial quota of each request in bytes, 0 disables the flow control
+	window   int
+	balancer Balancer
+	backoff  backoff
+	// createAttempts is the count of tunnels tried to create a request
+	createAttempts int
+	// createTimeout bound each attempt, including the wait for the write lock of the tunnel
+	createTimeout time.Duration
+}
+
+func defaultOptions() *options {
+	return &options{
+		balancer:       &roundRobinBalancer{},
+		backoff:        backoff{base: defaultBackoffBase, max: defaultBackoffMax},
+		createAttempts: defaultCreateAttempts,
+		createTimeout:  defaultCreateTimeout,
+	}
+}
+
+// WithFlowWindow enable the flow control of requests, the client and the server
+// can each send window bytes of a request before the other side refresh the quota.
+// The window is sent as the window query parameter of the websocket url and is not
+// negotiated: a server which does not support cMDReqRefreshQuota never refresh the quota,
+// and each request hangs once it has sent window bytes. 0 disables the flow control
+func WithFlowWindow(window int) Option {
+	return func(o *options) {
+		if window < 0 {
+			window = 0
+		}
+		o.window = window
+	}
+}
+
+// WithBalancer set how the tunnel of a new request is picked, the default is round-robin
+func WithBalancer(balancer Balancer) Option {
+	return func(o *options) {
+		if balancer != nil {
+			o.balancer = balancer
+		}
+	}
+}
+
+// WithReconnectBackoff set the exponential backoff of the reconnects of a broken tunnel,
+// the first reconnect wait about base, and the wait double after each failure up to max
+func WithReconnectBackoff(base, max time.Duration) Option {
+	return func(o *options) {
+		if base <= 0 || max < base {
+			return
+		}
+		o.backoff = backoff{base: base, max: max}
+	}
+}
+
+// WithCreateRetry set how many tunnels are tried to create a request, and the timeout
+// of the create on each tunnel. 0 keeps the default of 3 attempts and 5 seconds
+func WithCreateRetry(attempts int, timeout time.Duration) Option {
+	return func(o *options) {
+		if attempts > 0 {
+			o.createAttempts = attempts
+		}
+		if timeout > 0 {
+			o.createTimeout = timeout
+		}
+	}
+}
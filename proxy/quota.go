@@ -0,0 +1,58 @@
+package proxy
+
+import "sync"
+
+// quota is the count of bytes of a request the client can still send to the server,
+// serveConn wait on it when it is exhausted until the server refresh it
+type quota struct {
+	lock      sync.Mutex
+	cond      *sync.Cond
+	available int
+	closed    bool
+}
+
+func newQuota(window int) *quota {
+	q := &quota{available: window}
+	q.cond = sync.NewCond(&q.lock)
+	return q
+}
+
+// acquire wait until some quota is available and take at most max of it,
+// returns false if the quota is closed because the request is freed
+func (q *quota) acquire(max int) (int, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for q.available <= 0 && !q.closed {
+		q.cond.Wait()
+	}
+
+	if q.closed {
+		return 0, false
+	}
+
+	n := q.available
+	if n > max {
+		n = max
+	}
+	q.available -= n
+	return n, true
+}
+
+// release add n to the available quota, by a refresh of the server or the unused part of acquire
+func (q *quota) release(n int) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.available += n
+	q.cond.Broadcast()
+}
+
+// close wake up the waiting acquire
+func (q *quota) close() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.closed = true
+	q.cond.Broadcast()
+}
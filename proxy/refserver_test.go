@@ -0,0 +1,303 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// refServer is a reference tunnel server, it echo the data of each request back
+// and honor the flow control if the client connect with a window
+type refServer struct {
+	srv *httptest.Server
+	// URL is the websocket url of the tunnel
+	URL string
+
+	lock sync.Mutex
+	// hold stop granting quota to the clients until grant is called
+	hold     bool
+	conns    []*refConn
+	requests map[uint32]*refRequest
+	// the count of refresh frames received from the clients
+	refreshes int
+	// a client sent more than its quota
+	violated bool
+	// the query of the last websocket connection
+	query map[string]string
+	// reject the websocket connections with 503
+	reject bool
+	// the count of websocket connections accepted
+	connects int
+}
+
+type refConn struct {
+	conn      *websocket.Conn
+	writeLock sync.Mutex
+	window    int
+}
+
+type refRequest struct {
+	conn *refConn
+	idx  uint16
+	tag  uint16
+	// bytes received and bytes granted to the client, including the initial window
+	received int
+	granted  int
+	// server data waiting for the quota of the client
+	pending    []byte
+	sendCredit int
+}
+
+func newRefServer(t *testing.T) *refServer {
+	s := &refServer{requests: make(map[uint32]*refRequest)}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serve))
+	s.URL = "ws" + strings.TrimPrefix(s.srv.URL, "http") + "/tun"
+	t.Cleanup(s.close)
+	return s
+}
+
+func (s *refServer) close() {
+	s.lock.Lock()
+	for _, c := range s.conns {
+		c.conn.Close()
+	}
+	s.lock.Unlock()
+	s.srv.Close()
+}
+
+// setReject make the server refuse the new connections
+func (s *refServer) setReject(reject bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.reject = reject
+}
+
+// dropConns close the websocket connections, as a broken network
+func (s *refServer) dropConns() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, c := range s.conns {
+		c.conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *refServer) connectCount() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.connects
+}
+
+func (s *refServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	reject := s.reject
+	s.lock.Unlock()
+	if reject {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	window, _ := strconv.Atoi(r.URL.Query().Get("window"))
+	c := &refConn{conn: conn, window: window}
+
+	s.lock.Lock()
+	s.conns = append(s.conns, c)
+	s.connects++
+	s.query = make(map[string]string)
+	for key := range r.URL.Query() {
+		s.query[key] = r.URL.Query().Get(key)
+	}
+	s.lock.Unlock()
+
+	defer conn.Close()
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		s.onMessage(c, message)
+	}
+}
+
+func (s *refServer) onMessage(c *refConn, message []byte) {
+	cmd := message[0]
+	if cmd == cMDPing {
+		message[0] = cMDPong
+		c.write(message)
+		return
+	}
+
+	idx := binary.LittleEndian.Uint16(message[1:])
+	tag := binary.LittleEndian.Uint16(message[3:])
+	key := uint32(idx)<<16 | uint32(tag)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	switch cmd {
+	case cMDReqCreated:
+		s.requests[key] = &refRequest{conn: c, idx: idx, tag: tag, granted: c.window, sendCredit: c.window}
+	case cMDReqData:
+		req := s.requests[key]
+		if req == nil {
+			return
+		}
+
+		data := message[5:]
+		req.received += len(data)
+		if c.window > 0 && req.received > req.granted {
+			s.violated = true
+		}
+
+		req.pending = append(req.pending, data...)
+		req.flush()
+
+		if c.window > 0 && !s.hold {
+			req.grant(len(data))
+		}
+	case cMDReqRefreshQuota:
+		s.refreshes++
+		if req := s.requests[key]; req != nil {
+			req.sendCredit += int(binary.LittleEndian.Uint32(message[5:]))
+			req.flush()
+		}
+	case cMDReqClientClosed:
+		delete(s.requests, key)
+	}
+}
+
+// grant give the clients the quota of all the data received while holding, and stop holding
+func (s *refServer) grant() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.hold = false
+	for _, req := range s.requests {
+		if n := req.received + req.conn.window - req.granted; n > 0 {
+			req.grant(n)
+		}
+	}
+}
+
+func (s *refServer) setHold(hold bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.hold = hold
+}
+
+// received returns the count of bytes received of all requests
+func (s *refServer) received() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	received := 0
+	for _, req := range s.requests {
+		received += req.received
+	}
+	return received
+}
+
+// flush send the pending data as far as the quota of the client allows
+func (req *refRequest) flush() {
+	for len(req.pending) > 0 {
+		n := len(req.pending)
+		if req.conn.window > 0 {
+			if req.sendCredit <= 0 {
+				return
+			}
+
+			if n > req.sendCredit {
+				n = req.sendCredit
+			}
+			req.sendCredit -= n
+		}
+
+		buf := make([]byte, 5+n)
+		buf[0] = cMDReqData
+		binary.LittleEndian.PutUint16(buf[1:], req.idx)
+		binary.LittleEndian.PutUint16(buf[3:], req.tag)
+		copy(buf[5:], req.pending[:n])
+		req.conn.write(buf)
+		req.pending = req.pending[n:]
+	}
+}
+
+func (req *refRequest) grant(n int) {
+	req.granted += n
+
+	buf := make([]byte, 9)
+	buf[0] = cMDReqRefreshQuota
+	binary.LittleEndian.PutUint16(buf[1:], req.idx)
+	binary.LittleEndian.PutUint16(buf[3:], req.tag)
+	binary.LittleEndian.PutUint32(buf[5:], uint32(n))
+	req.conn.write(buf)
+}
+
+func (c *refConn) write(message []byte) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	c.conn.WriteMessage(websocket.BinaryMessage, message)
+}
+
+// connPair returns the two ends of a local tcp connection
+func connPair(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := l.Accept()
+		accepted <- conn
+	}()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case conn := <-accepted:
+		t.Cleanup(func() {
+			client.Close()
+			conn.Close()
+		})
+		return client, conn
+	case <-time.After(5 * time.Second):
+		t.Fatal("accept timeout")
+	}
+	return nil, nil
+}
+
+// waitFor poll cond until it returns true or timeout
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("wait timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
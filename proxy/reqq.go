@@ -2,12 +2,17 @@ package proxy
 
 import (
 	"net"
+	"sync"
 )
 
 type Reqq struct {
-	cap      int
+	cap int
+	// window is the initial quota of a request, 0 if the flow control is disabled
+	window   int
 	requests []*Request
-	// lock      sync.Mutex
+	// lock protect freeIdx, freeCount and the tag, quota and drained of the requests,
+	// the requests are freed by serveConn and read by the websocket goroutine
+	lock      sync.Mutex
 	freeIdx   *FreeIdx
 	freeCount int
 }
@@ -23,7 +28,7 @@ type Reqq struct {
 // }
 
 // console.log("Reqq construct, cap:", cap);
-func newReqq(cap int) *Reqq {
+func newReqq(cap int, window int) *Reqq {
 	requests := make([]*Request, 0, cap)
 	freeIdx := newFreeIdx()
 	for i := 0; i < cap; i++ {
@@ -31,10 +36,13 @@ func newReqq(cap int) *Reqq {
 		freeIdx.push(uint16(i))
 	}
 
-	return &Reqq{cap: cap, requests: requests, freeIdx: freeIdx, freeCount: cap}
+	return &Reqq{cap: cap, window: window, requests: requests, freeIdx: freeIdx, freeCount: cap}
 }
 
 func (r *Reqq) reqValid(idx, tag uint16) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
 	if idx < 0 || idx >= uint16(len(r.requests)) {
 		return false
 	}
@@ -48,7 +56,10 @@ func (r *Reqq) reqValid(idx, tag uint16) bool {
 }
 
 func (r *Reqq) getReq(idx, tag uint16) *Request {
-	if idx < 0 || int(idx) > len(r.requests) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if idx < 0 || int(idx) >= len(r.requests) {
 		return nil
 	}
 
@@ -61,6 +72,9 @@ func (r *Reqq) getReq(idx, tag uint16) *Request {
 }
 
 func (r *Reqq) allocReq(conn net.Conn) *Request {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
 	if r.freeIdx.length() < 1 {
 		return nil
 	}
@@ -70,6 +84,10 @@ func (r *Reqq) allocReq(conn net.Conn) *Request {
 	req.tag = req.tag + 1
 	req.inused = true
 	req.conn = conn
+	req.drained = 0
+	if r.window > 0 {
+		req.quota = newQuota(r.window)
+	}
 
 	r.freeCount--
 	return req
@@ -77,17 +95,19 @@ func (r *Reqq) allocReq(conn net.Conn) *Request {
 
 func (r *Reqq) free(idx uint16, tag uint16) {
 	length := len(r.requests)
-	if idx < 0 || idx > uint16(length) {
+	if idx < 0 || idx >= uint16(length) {
 		return
 	}
 
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
 	req := r.requests[idx]
 	if req.tag != tag {
 		return
 	}
 
 	req.dofree()
-
 	req.inused = false
 	req.tag = req.tag + 1
 
@@ -95,18 +115,75 @@ func (r *Reqq) free(idx uint16, tag uint16) {
 	r.freeCount++
 }
 
+// getQuota returns the quota of the request, nil if the request is freed
+// or the flow control is disabled. Use the returned quota, not req.quota
+func (r *Reqq) getQuota(idx, tag uint16) *quota {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if int(idx) >= len(r.requests) {
+		return nil
+	}
+
+	req := r.requests[idx]
+	if req.tag != tag {
+		return nil
+	}
+	return req.quota
+}
+
+// drain count n bytes of server data written to the local socket, and returns
+// the bytes to refresh to the server once half a window is drained, 0 otherwise
+func (r *Reqq) drain(idx, tag uint16, n int) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if int(idx) >= len(r.requests) {
+		return 0
+	}
+
+	req := r.requests[idx]
+	if req.tag != tag || req.quota == nil {
+		return 0
+	}
+
+	req.drained += n
+	if req.drained < r.window/2 {
+		return 0
+	}
+
+	drained := req.drained
+	req.drained = 0
+	return drained
+}
+
 func (r *Reqq) isFulled() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
 	return r.freeCount < 1
 }
 
 func (r *Reqq) reqCount() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
 	return r.cap - r.freeCount
 }
 
 func (r *Reqq) cleanup() {
+	r.lock.Lock()
+	inused := make([]*Request, 0, len(r.requests))
+	tags := make([]uint16, 0, len(r.requests))
 	for _, request := range r.requests {
 		if request.inused {
-			r.free(request.idx, request.tag)
+			inused = append(inused, request)
+			tags = append(tags, request.tag)
 		}
 	}
+	r.lock.Unlock()
+
+	for i, request := range inused {
+		r.free(request.idx, tags[i])
+	}
 }
@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestFreeWhileRefreshQuota free the requests while the websocket goroutine
+// refresh their quota and drain their data, run it with -race
+func TestFreeWhileRefreshQuota(t *testing.T) {
+	tun := &Tunnel{reqq: newReqq(1, 1024)}
+
+	for i := 0; i < 200; i++ {
+		req := tun.reqq.allocReq(nil)
+		if req == nil {
+			t.Fatal("alloc request failed")
+		}
+		idx, tag := req.idx, req.tag
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				tun.onServerRefreshQuota(idx, tag, 512)
+				tun.reqq.drain(idx, tag, 512)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			tun.reqq.free(idx, tag)
+		}()
+		wg.Wait()
+
+		if tun.reqq.getQuota(idx, tag) != nil {
+			t.Fatal("expect no quota after free")
+		}
+	}
+}
+
+func TestDrain(t *testing.T) {
+	r := newReqq(1, 1024)
+	req := r.allocReq(nil)
+
+	if n := r.drain(req.idx, req.tag, 500); n != 0 {
+		t.Fatalf("refresh %d before half window", n)
+	}
+	if n := r.drain(req.idx, req.tag, 100); n != 600 {
+		t.Fatalf("refresh %d, expect 600", n)
+	}
+	if n := r.drain(req.idx, req.tag+1, 600); n != 0 {
+		t.Fatalf("refresh %d of a stale tag", n)
+	}
+}
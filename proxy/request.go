@@ -10,6 +10,11 @@ type Request struct {
 	tag    uint16
 	inused bool
 	conn   net.Conn
+
+	// quota is nil if the flow control is disabled
+	quota *quota
+	// bytes of server data written to conn since the last refresh of the server quota
+	drained int
 }
 
 func newRequest(idx uint16) *Request {
@@ -50,9 +55,15 @@ func (r *Request) onServerFinished() error {
 	return nil
 }
 
+// dofree is called with the lock of Reqq held
 func (r *Request) dofree() {
 	if r.conn != nil {
 		r.conn.Close()
 		r.conn = nil
 	}
+
+	if q := r.quota; q != nil {
+		r.quota = nil
+		q.close()
+	}
 }
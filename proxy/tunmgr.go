@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"fmt"
 	"net"
 	"time"
 
@@ -48,13 +49,19 @@ type TunMgr struct {
 	// ctxCancel      context.CancelFunc
 	// nodes []*Node
 	tunPool *TunPool
+	opts    *options
 }
 
-func NewTunManager(tunCount, tunCap int, tunSelector selector.TunSelector) *TunMgr {
+func NewTunManager(tunCount, tunCap int, tunSelector selector.TunSelector, opts ...Option) *TunMgr {
 	// if len() == 0 {
 	// 	panic("url can not empty")
 	// }
-	tm := &TunMgr{tunnelCount: tunCount, tunnelCap: tunCap, selector: tunSelector}
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	tm := &TunMgr{tunnelCount: tunCount, tunnelCap: tunCap, selector: tunSelector, opts: o}
 	return tm
 
 	// return &TunMgr{
@@ -87,8 +94,9 @@ func (tm *TunMgr) Startup() {
 	// go tm.keepAlive()
 	// go tm.doSortTunnels()
 	tunPool := newTunPool(tm.tunnelCount, tm.tunnelCap, tm.selector, tm)
-	tunPool.startup()
+	// the tunnels report to the pool as soon as they are connected
 	tm.tunPool = tunPool
+	tunPool.startup()
 }
 
 func (tm *TunMgr) Reset(tunInfo *selector.TunInfo) error {
@@ -96,55 +104,78 @@ func (tm *TunMgr) Reset(tunInfo *selector.TunInfo) error {
 }
 
 func (tm *TunMgr) OnAcceptRequest(conn net.Conn, dest *DestAddr) {
-	// allocate tunnel for sock
-	tun := tm.allocTunnelForRequest()
-	if tun == nil {
-		log.Errorf("[TunMgr] failed to alloc tunnel for sock, discard it")
+	tun, req, err := tm.createRequest(conn, dest)
+	if err != nil {
+		log.Errorf("[TunMgr] %s, discard sock", err.Error())
+		conn.Close()
 		return
 	}
 
 	log.Debug("OnAcceptRequest alloc tun ", tun.uuid)
 
-	if err := tun.onAcceptRequest(conn, dest); err != nil {
+	if err := tun.onAcceptRequest(conn, req); err != nil {
 		log.Errorf("onAcceptRequest %s", err.Error())
 	}
 }
 
 func (tm *TunMgr) OnAcceptHTTPsRequest(conn net.Conn, dest *DestAddr) {
-	// allocate tunnel for sock
-	tun := tm.allocTunnelForRequest()
-	if tun == nil {
-		log.Errorf("[TunMgr] failed to alloc tunnel for sock, discard it")
+	tun, req, err := tm.createRequest(conn, dest)
+	if err != nil {
+		log.Errorf("[TunMgr] %s, discard sock", err.Error())
+		conn.Close()
 		return
 	}
 
-	if err := tun.onAcceptHTTPsRequest(conn, dest); err != nil {
+	if err := tun.onAcceptHTTPsRequest(conn, dest, req); err != nil {
 		log.Errorf("onAcceptHTTPRequest %s", err.Error())
 	}
 }
 
 func (tm *TunMgr) OnAcceptHTTPRequest(conn net.Conn, dest *DestAddr, header []byte) {
-	// allocate tunnel for sock
-	tun := tm.allocTunnelForRequest()
-	if tun == nil {
-		log.Errorf("[TunMgr] failed to alloc tunnel for sock, discard it")
+	tun, req, err := tm.createRequest(conn, dest)
+	if err != nil {
+		log.Errorf("[TunMgr] %s, discard sock", err.Error())
+		conn.Close()
 		return
 	}
 
-	if err := tun.onAcceptHTTPRequest(conn, dest, header); err != nil {
+	if err := tun.onAcceptHTTPRequest(conn, dest, req, header); err != nil {
 		log.Errorf("onAcceptHTTPRequest %s", err.Error())
 	}
 }
 
-func (t *Tunnel) onAcceptHTTPsRequest(conn net.Conn, dest *DestAddr) error {
-	log.Infof("onAcceptHTTPsRequest, dest addr %s port %d", dest.Addr, dest.Port)
+// createRequest create the request of conn on a tunnel. No payload has flowed before
+// the create is sent, so a failed create is retried on the next eligible tunnel
+// up to the create attempts of the options
+func (tm *TunMgr) createRequest(conn net.Conn, dest *DestAddr) (*Tunnel, *Request, error) {
+	tried := make(map[*Tunnel]bool)
+	var lastErr error
+	for attempt := 1; attempt <= tm.opts.createAttempts; attempt++ {
+		tun := tm.tunPool.allocTunnelForRequest(tried)
+		if tun == nil {
+			break
+		}
+		tried[tun] = true
+
+		req, err := tun.acceptRequestInternal(conn, dest, tm.opts.createTimeout)
+		if err == nil {
+			return tun, req, nil
+		}
+
+		log.Warnf("[TunMgr] create request %s:%d on tunnel %s node %s failed %s, attempt %d", dest.Addr, dest.Port, tun.uuid, tun.targetNodeID, err.Error(), attempt)
+		lastErr = err
+	}
 
-	req, err := t.acceptRequestInternal(conn, dest)
-	if err != nil {
-		return err
+	if lastErr != nil {
+		return nil, nil, fmt.Errorf("create request %s:%d failed after %d attempts: %s", dest.Addr, dest.Port, len(tried), lastErr.Error())
 	}
+	return nil, nil, fmt.Errorf("failed to alloc tunnel for sock")
+}
 
-	_, err = conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n" +
+func (t *Tunnel) onAcceptHTTPsRequest(conn net.Conn, dest *DestAddr, req *Request) error {
+	log.Infof("onAcceptHTTPsRequest, dest addr %s port %d", dest.Addr, dest.Port)
+
+	_, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n" +
 		"Proxy-agent: linproxy\r\n" +
 		"\r\n"))
 	if err != nil {
@@ -154,12 +185,8 @@ func (t *Tunnel) onAcceptHTTPsRequest(conn net.Conn, dest *DestAddr) error {
 	return t.serveConn(conn, req.idx, req.tag)
 }
 
-func (t *Tunnel) onAcceptHTTPRequest(conn net.Conn, dest *DestAddr, header []byte) error {
+func (t *Tunnel) onAcceptHTTPRequest(conn net.Conn, dest *DestAddr, req *Request, header []byte) error {
 	log.Infof("onAcceptHTTPRequest, dest addr %s port %d", dest.Addr, dest.Port)
-	req, err := t.acceptRequestInternal(conn, dest)
-	if err != nil {
-		return err
-	}
 
 	defer t.onClientRecvFinished(req.idx, req.tag)
 
@@ -193,7 +220,7 @@ func (tm *TunMgr) allocTunnelForRequest() *Tunnel {
 	// }
 
 	// return nil
-	return tm.tunPool.allocTunnelForRequest()
+	return tm.tunPool.allocTunnelForRequest(nil)
 }
 
 // func (tm *TunMgr) doSortTunnels() {
@@ -268,6 +295,14 @@ func (tm *TunMgr) allocTunnelForRequest() *Tunnel {
 // 	}
 // }
 
+// Stats returns a snapshot of the tunnels, the fastest first
+func (tm *TunMgr) Stats() []TunnelStats {
+	if tm.tunPool == nil {
+		return nil
+	}
+	return tm.tunPool.stats()
+}
+
 func (tm *TunMgr) onTunnelBroken(tun *Tunnel) {
 	tm.tunPool.onTunnelBroken(tun)
 }
@@ -35,13 +35,14 @@ const (
 	// server notify client that a request has closed
 	cMDReqServerClosed = 8
 	// server notify client that a request quota has been refresh,
-	// means that client can send more data of this request
+	// means that client can send more data of this request.
+	// client send it to server too, when the data of server has drained to the local socket.
+	// 4 bytes quota follow idx and tag
 	cMDReqRefreshQuota = 9
 	cMDReqEnd          = 10
 )
 
 const maxCap = 100
-const maxDelays = 10
 
 type Tunnel struct {
 	uuid string
@@ -59,10 +60,11 @@ type Tunnel struct {
 	authKey      string
 	targetNodeID string
 
-	isDestroy    bool
-	lastPongTime time.Time
-	// save last 10 delay, calculation of average values
-	delays []int
+	isDestroy bool
+	// connLock protect conn and isDestroy, the tunnel is reconnected by the pool
+	connLock sync.Mutex
+	// latency collect the round trips of the pings
+	latency *latencyStats
 }
 
 func newTunnel(uuid string, tunmgr *TunMgr, tunCap int, tunInfo *selector.TunInfo) (*Tunnel, error) {
@@ -72,21 +74,19 @@ func newTunnel(uuid string, tunmgr *TunMgr, tunCap int, tunInfo *selector.TunInf
 		tunmgr:       tunmgr,
 		cap:          tunCap,
 		writeLock:    sync.Mutex{},
-		reqq:         newReqq(tunCap),
+		reqq:         newReqq(tunCap, tunmgr.opts.window),
 		url:          tunInfo.URL,
 		relays:       tunInfo.Relays,
 		authKey:      tunInfo.Auth,
 		targetNodeID: tunInfo.NodeID,
-
-		lastPongTime: time.Now(),
+		latency:      newLatencyStats(),
 	}
 
+	// the pool start serveWebsocket once the tunnel is in the pool
 	if err := tun.connect(); err != nil {
 		log.Warnf(" new turnnel faile %s", err.Error())
 		// tun.tunmgr.onTunnelBroken(tun)
 		return nil, err
-	} else {
-		go tun.serveWebsocket()
 	}
 
 	return tun, nil
@@ -94,6 +94,10 @@ func newTunnel(uuid string, tunmgr *TunMgr, tunCap int, tunInfo *selector.TunInf
 
 func (t *Tunnel) connect() error {
 	url := fmt.Sprintf("%s?cap=%d&uuid=%s", t.url, t.cap, t.uuid)
+	if t.reqq.window > 0 {
+		// tell the server to enable the flow control
+		url = fmt.Sprintf("%s&window=%d", url, t.reqq.window)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -114,7 +118,11 @@ func (t *Tunnel) connect() error {
 		}
 		return fmt.Errorf("dial %s failed %s", url, err.Error())
 	}
+	t.connLock.Lock()
 	t.conn = conn
+	t.connLock.Unlock()
+	// the pongs of the last connection do not count
+	t.latency.touch()
 
 	// log.Infof("response header: %#v", resp.Header)
 	log.Infof("new tun %s", url)
@@ -122,17 +130,43 @@ func (t *Tunnel) connect() error {
 }
 
 func (t *Tunnel) destroy() error {
+	t.connLock.Lock()
+	defer t.connLock.Unlock()
+
+	t.isDestroy = true
 	if t.conn != nil {
 		return t.conn.Close()
 	}
-	t.isDestroy = true
-
 	return nil
 }
 
+func (t *Tunnel) isDestroyed() bool {
+	t.connLock.Lock()
+	defer t.connLock.Unlock()
+
+	return t.isDestroy
+}
+
+func (t *Tunnel) getConn() *websocket.Conn {
+	t.connLock.Lock()
+	defer t.connLock.Unlock()
+
+	return t.conn
+}
+
+// breakConn close the websocket, serveWebsocket then report the tunnel broken
+func (t *Tunnel) breakConn() {
+	if conn := t.getConn(); conn != nil {
+		conn.Close()
+	}
+}
+
 func (t *Tunnel) serveWebsocket() error {
 	defer t.onWebsocketClose()
-	conn := t.conn
+	conn := t.getConn()
+	if conn == nil {
+		return fmt.Errorf("t.conn == nil ")
+	}
 	for {
 		messageType, p, err := conn.ReadMessage()
 		if err != nil {
@@ -152,19 +186,22 @@ func (t *Tunnel) serveWebsocket() error {
 }
 
 func (t *Tunnel) onWebsocketClose() {
+	t.connLock.Lock()
 	if t.conn != nil {
 		t.conn.Close()
 		t.conn = nil
 	}
+	t.connLock.Unlock()
 
 	t.reqq.cleanup()
 
 	t.tunmgr.onTunnelBroken(t)
 }
 
+// reconnect dial the node again with the same uuid,
+// the caller retry with backoff if it fails
 func (t *Tunnel) reconnect() error {
 	if err := t.connect(); err != nil {
-		t.tunmgr.onTunnelBroken(t)
 		return err
 	}
 
@@ -173,10 +210,9 @@ func (t *Tunnel) reconnect() error {
 }
 
 func (t *Tunnel) sendPing() error {
-	now := time.Now()
 	buf := make([]byte, 9)
 	buf[0] = byte(cMDPing)
-	binary.LittleEndian.PutUint64(buf[1:], uint64(now.Unix()))
+	binary.LittleEndian.PutUint64(buf[1:], monoNow())
 	return t.write(buf)
 }
 
@@ -224,16 +260,14 @@ func (t *Tunnel) onPong(message []byte) error {
 	if len(message) != 9 {
 		return fmt.Errorf("message len != 9")
 	}
+	// the timestamp is the monotonic nanoseconds when the ping was sent
 	timestamp := binary.LittleEndian.Uint64(message[1:])
-	delay := time.Now().UnixMilli() - int64(timestamp)
-	t.delays = append(t.delays, int(delay))
-
-	if len(t.delays) > 10 {
-		length := len(t.delays)
-		t.delays = t.delays[length-maxDelays:]
+	now := monoNow()
+	if timestamp > now {
+		return fmt.Errorf("pong timestamp %d is in the future", timestamp)
 	}
 
-	t.lastPongTime = time.Now()
+	t.latency.add(time.Duration(now - timestamp))
 	return nil
 }
 
@@ -250,6 +284,11 @@ func (t *Tunnel) onTunnelRequestMessage(cmd uint8, message []byte) error {
 		return t.onServerRecvFinish(idx, tag)
 	case uint8(cMDReqServerClosed):
 		t.onServerRecvClose(idx, tag)
+	case uint8(cMDReqRefreshQuota):
+		if len(message) != 9 {
+			return fmt.Errorf("refresh quota message len != 9")
+		}
+		return t.onServerRefreshQuota(idx, tag, binary.LittleEndian.Uint32(message[5:]))
 	default:
 		log.Errorf("[Tunnel]unknown cmd:", cmd)
 	}
@@ -264,7 +303,28 @@ func (t *Tunnel) onServerRequestData(idx, tag uint16, data []byte) error {
 		// return fmt.Errorf("onServerRequestData can not find request, idx %d, tag %d", idx, tag)
 		return nil
 	}
-	return req.write(data)
+
+	if err := req.write(data); err != nil {
+		return err
+	}
+
+	// the data has drained to the local socket, let the server send more
+	drained := t.reqq.drain(idx, tag, len(data))
+	if drained == 0 {
+		return nil
+	}
+	return t.sendRefreshQuota(idx, tag, uint32(drained))
+}
+
+func (t *Tunnel) onServerRefreshQuota(idx, tag uint16, n uint32) error {
+	log.Debugf("onServerRefreshQuota, idx:%d tag:%d, quota:%d", idx, tag, n)
+	q := t.reqq.getQuota(idx, tag)
+	if q == nil {
+		return nil
+	}
+
+	q.release(int(n))
+	return nil
 }
 
 func (t *Tunnel) onServerRecvFinish(idx, tag uint16) error {
@@ -282,40 +342,57 @@ func (t *Tunnel) onServerRecvClose(idx, tag uint16) {
 	t.reqq.free(idx, tag)
 }
 
-func (t *Tunnel) onAcceptRequest(conn net.Conn, dest *DestAddr) error {
-	log.Debugf("onAcceptRequest, dest %s:%d", dest.Addr, dest.Port)
-
-	req, err := t.acceptRequestInternal(conn, dest)
-	if err != nil {
-		return err
-	}
-
+func (t *Tunnel) onAcceptRequest(conn net.Conn, req *Request) error {
 	log.Debugf("onAcceptRequest, alloc idx %d tag %d", req.idx, req.tag)
 	return t.serveConn(conn, req.idx, req.tag)
 }
 
-func (t *Tunnel) acceptRequestInternal(conn net.Conn, destAddr *DestAddr) (*Request, error) {
+// acceptRequestInternal alloc a request for conn and send the create to the server,
+// the create fails after timeout including the wait for the write lock, 0 means no timeout.
+// If it fails the request is freed and conn is left open, so it can be retried on another tunnel
+func (t *Tunnel) acceptRequestInternal(conn net.Conn, destAddr *DestAddr, timeout time.Duration) (*Request, error) {
 	if !t.isConnected() {
 		return nil, fmt.Errorf("[Tunnel] accept sock failed, tunnel is disconnected")
 	}
 
 	req := t.reqq.allocReq(conn)
 	if req == nil {
-		return nil, fmt.Errorf("[Tunnel] allocReq failed, discard sock")
+		return nil, fmt.Errorf("[Tunnel] allocReq failed, tunnel is full")
 	}
 
 	// send create message to server
-	err := t.sendCreate2Server(req, destAddr)
+	if err := t.sendCreate2Server(req, destAddr, timeout); err != nil {
+		// no payload has flowed yet, detach conn so that free does not close it
+		req.conn = nil
+		t.reqq.free(req.idx, req.tag)
+		return nil, err
+	}
 
-	return req, err
+	return req, nil
 }
 
 func (t *Tunnel) serveConn(conn net.Conn, idx uint16, tag uint16) error {
 	defer conn.Close()
 
+	q := t.reqq.getQuota(idx, tag)
+
 	buf := make([]byte, 4096)
 	for {
-		n, err := conn.Read(buf)
+		readBuf := buf
+		if q != nil {
+			// pause reading until the server refresh the quota
+			n, ok := q.acquire(len(buf))
+			if !ok {
+				return nil
+			}
+			readBuf = buf[:n]
+		}
+
+		n, err := conn.Read(readBuf)
+		if q != nil && n < len(readBuf) {
+			q.release(len(readBuf) - n)
+		}
+
 		if err != nil {
 			// log.Debugf("serveConn: %s", err.Error())
 			// if err == io.EOF {
@@ -373,7 +450,7 @@ func (t *Tunnel) onClientRecvData(idx, tag uint16, data []byte) error {
 	return t.write(buf)
 }
 
-func (t *Tunnel) sendCreate2Server(req *Request, destAddr *DestAddr) error {
+func (t *Tunnel) sendCreate2Server(req *Request, destAddr *DestAddr, timeout time.Duration) error {
 	addrLength := len(destAddr.Addr)
 	buf := make([]byte, 9+addrLength)
 
@@ -399,11 +476,50 @@ func (t *Tunnel) sendCreate2Server(req *Request, destAddr *DestAddr) error {
 	offset := 7 + addrLength
 	binary.LittleEndian.PutUint16(buf[offset:], uint16(destAddr.Port))
 
-	if t.isConnected() {
+	if !t.isConnected() {
+		return fmt.Errorf("[Tunnel] sendCreate2Server failed, tunnel is disconnected")
+	}
+
+	if timeout <= 0 {
 		return t.write(buf)
 	}
 
-	return fmt.Errorf("[Tunnel] sendCreate2Server failed, tunnel is disconnected")
+	// the timeout cover the wait for the write lock, e.g. behind a large data frame.
+	// A create which times out is abandoned but the tunnel is kept
+	done := make(chan error, 1)
+	go func() {
+		done <- t.write(buf)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("[Tunnel] sendCreate2Server failed %s", err.Error())
+		}
+		return nil
+	case <-timer.C:
+		// the create may still be sent later, then tell the server to drop the request
+		idx, tag := req.idx, req.tag
+		go func() {
+			if err := <-done; err == nil {
+				t.sendCtl2Server(uint8(cMDReqClientClosed), idx, tag)
+			}
+		}()
+		return fmt.Errorf("[Tunnel] sendCreate2Server timeout after %s", timeout)
+	}
+}
+
+// sendRefreshQuota let the server send n more bytes of the request
+func (t *Tunnel) sendRefreshQuota(idx, tag uint16, n uint32) error {
+	buf := make([]byte, 9)
+	buf[0] = uint8(cMDReqRefreshQuota)
+	binary.LittleEndian.PutUint16(buf[1:], idx)
+	binary.LittleEndian.PutUint16(buf[3:], tag)
+	binary.LittleEndian.PutUint32(buf[5:], n)
+	return t.write(buf)
 }
 
 func (t *Tunnel) sendCtl2Server(cmd uint8, idx, tag uint16) error {
@@ -415,13 +531,15 @@ func (t *Tunnel) sendCtl2Server(cmd uint8, idx, tag uint16) error {
 }
 
 func (t *Tunnel) write(data []byte) error {
+	conn := t.getConn()
+	if conn == nil {
+		return fmt.Errorf("t.conn == nil ")
+	}
+
 	t.writeLock.Lock()
 	defer t.writeLock.Unlock()
 
-	if t.conn == nil {
-		return fmt.Errorf("t.conn == nil ")
-	}
-	return t.conn.WriteMessage(websocket.BinaryMessage, data)
+	return conn.WriteMessage(websocket.BinaryMessage, data)
 }
 
 func (t *Tunnel) getServiceID(r *http.Request) string {
@@ -446,10 +564,37 @@ func (t *Tunnel) getHeaderString(r *http.Request, serviceID string) string {
 	return headerString
 }
 
+// NodeID returns the id of the node the tunnel connect to
+func (t *Tunnel) NodeID() string {
+	return t.targetNodeID
+}
+
+// ActiveRequests returns the count of requests on the tunnel
+func (t *Tunnel) ActiveRequests() int {
+	return t.reqq.reqCount()
+}
+
+// Latency returns the moving average of the round trip time, 0 if there is no pong yet
+func (t *Tunnel) Latency() time.Duration {
+	return t.latency.average()
+}
+
+// Stats returns a snapshot of the tunnel
+func (t *Tunnel) Stats() TunnelStats {
+	return TunnelStats{
+		NodeID:         t.targetNodeID,
+		URL:            t.url,
+		Connected:      t.isConnected(),
+		ActiveRequests: t.ActiveRequests(),
+		LastPong:       t.latency.lastPongTime(),
+		Latency:        t.latency.snapshot(),
+	}
+}
+
 func (t *Tunnel) isFulled() bool {
 	return t.reqq.isFulled()
 }
 
 func (t *Tunnel) isConnected() bool {
-	return t.conn != nil
+	return t.getConn() != nil
 }
@@ -0,0 +1,230 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/zscboy/titan-workers-sdk/selector"
+)
+
+func newTestTunMgr(t *testing.T, urls []string, opts ...Option) *TunMgr {
+	t.Helper()
+
+	tunInfos := make([]*selector.TunInfo, 0, len(urls))
+	for i, url := range urls {
+		tunInfos = append(tunInfos, &selector.TunInfo{NodeID: string(rune('a' + i)), URL: url})
+	}
+
+	tm := NewTunManager(len(urls), 10, selector.NewFixSelector(tunInfos), opts...)
+	tm.Startup()
+	return tm
+}
+
+// echo send data through the tunnel and returns what the reference server echo back
+func echo(t *testing.T, tm *TunMgr, data []byte) []byte {
+	t.Helper()
+
+	client, local := connPair(t)
+	go tm.OnAcceptRequest(local, &DestAddr{Addr: "example.com", Port: 80})
+
+	go client.Write(data)
+
+	buf := make([]byte, len(data))
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(client, buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func TestFlowControl(t *testing.T) {
+	s := newRefServer(t)
+	tm := newTestTunMgr(t, []string{s.URL}, WithFlowWindow(1024))
+
+	data := make([]byte, 64*1024)
+	rand.Read(data)
+
+	if got := echo(t, tm, data); !bytes.Equal(got, data) {
+		t.Fatal("echo data mismatch")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.query["window"] != "1024" {
+		t.Fatalf("window query %q", s.query["window"])
+	}
+
+	if s.violated {
+		t.Fatal("client sent more than its quota")
+	}
+
+	// the client refresh the server quota each half window drained
+	if s.refreshes < len(data)/1024 {
+		t.Fatalf("client sent %d refreshes", s.refreshes)
+	}
+}
+
+func TestFlowControlPause(t *testing.T) {
+	s := newRefServer(t)
+	s.setHold(true)
+	tm := newTestTunMgr(t, []string{s.URL}, WithFlowWindow(1024))
+
+	client, local := connPair(t)
+	go tm.OnAcceptRequest(local, &DestAddr{Addr: "example.com", Port: 80})
+
+	data := make([]byte, 8*1024)
+	go client.Write(data)
+
+	waitFor(t, 5*time.Second, func() bool { return s.received() == 1024 })
+
+	// the client must wait for the quota
+	time.Sleep(50 * time.Millisecond)
+	if received := s.received(); received != 1024 {
+		t.Fatalf("server received %d bytes before refresh, window 1024", received)
+	}
+
+	s.grant()
+	waitFor(t, 5*time.Second, func() bool { return s.received() == len(data) })
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.violated {
+		t.Fatal("client sent more than its quota")
+	}
+}
+
+func TestNoFlowControl(t *testing.T) {
+	s := newRefServer(t)
+	tm := newTestTunMgr(t, []string{s.URL})
+
+	data := []byte("hello")
+	if got := echo(t, tm, data); !bytes.Equal(got, data) {
+		t.Fatalf("echo %q", got)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.query["window"]; ok || s.refreshes != 0 {
+		t.Fatal("flow control should be disabled")
+	}
+}
+
+// firstBalancer always pick the first eligible tunnel
+type firstBalancer struct{}
+
+func (firstBalancer) Pick(tunnels []*Tunnel) *Tunnel {
+	return tunnels[0]
+}
+
+// addBrokenTunnel put a tunnel in front of the pool whose websocket fails the writes,
+// its read goroutine is not running so the pool still see it connected
+func addBrokenTunnel(t *testing.T, tm *TunMgr, url string) *Tunnel {
+	t.Helper()
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.UnderlyingConn().Close()
+
+	tun := &Tunnel{uuid: "broken", tunmgr: tm, targetNodeID: "broken", reqq: newReqq(10, 0), conn: conn, latency: newLatencyStats()}
+
+	tm.tunPool.tunLock.Lock()
+	tm.tunPool.tunnels = append([]*Tunnel{tun}, tm.tunPool.tunnels...)
+	tm.tunPool.tunLock.Unlock()
+	return tun
+}
+
+func TestCreateRetry(t *testing.T) {
+	s := newRefServer(t)
+	tm := newTestTunMgr(t, []string{s.URL}, WithBalancer(firstBalancer{}))
+	broken := addBrokenTunnel(t, tm, s.URL)
+
+	data := []byte("hello")
+	if got := echo(t, tm, data); !bytes.Equal(got, data) {
+		t.Fatalf("echo %q", got)
+	}
+
+	// the create was tried on the broken tunnel first, and its request freed
+	tried := false
+	for _, req := range broken.reqq.requests {
+		tried = tried || req.tag != 0
+	}
+	if !tried {
+		t.Fatal("expect the broken tunnel tried first")
+	}
+	if broken.ActiveRequests() != 0 {
+		t.Fatalf("%d requests left on the broken tunnel", broken.ActiveRequests())
+	}
+}
+
+func TestCreateRetryExhausted(t *testing.T) {
+	s := newRefServer(t)
+	tm := newTestTunMgr(t, []string{s.URL}, WithBalancer(firstBalancer{}), WithCreateRetry(1, time.Second))
+	broken := addBrokenTunnel(t, tm, s.URL)
+
+	client, local := connPair(t)
+	tm.OnAcceptRequest(local, &DestAddr{Addr: "example.com", Port: 80})
+
+	// the sock is closed after the last attempt
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := client.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read %v, expect EOF", err)
+	}
+
+	if broken.ActiveRequests() != 0 {
+		t.Fatalf("%d requests left on the broken tunnel", broken.ActiveRequests())
+	}
+}
+
+func TestCreateTimeoutKeepTunnel(t *testing.T) {
+	s := newRefServer(t)
+	tm := newTestTunMgr(t, []string{s.URL}, WithCreateRetry(1, 50*time.Millisecond))
+	tun := tm.tunPool.getTunnels()[0]
+
+	// an unrelated request on the same tunnel
+	client, local := connPair(t)
+	go tm.OnAcceptRequest(local, &DestAddr{Addr: "example.com", Port: 80})
+	echoOn := func(data string) {
+		t.Helper()
+		go client.Write([]byte(data))
+		buf := make([]byte, len(data))
+		client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.ReadFull(client, buf); err != nil || string(buf) != data {
+			t.Fatalf("echo %q %v", buf, err)
+		}
+	}
+	echoOn("before")
+
+	// a large data frame hold the write lock longer than the create timeout
+	tun.writeLock.Lock()
+	slow, slowLocal := connPair(t)
+	tm.OnAcceptRequest(slowLocal, &DestAddr{Addr: "example.com", Port: 80})
+	tun.writeLock.Unlock()
+
+	slow.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := slow.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read %v, expect EOF of the timed out create", err)
+	}
+
+	if !tun.isConnected() {
+		t.Fatal("expect the tunnel kept")
+	}
+	echoOn("after")
+
+	// the abandoned create is closed once it's sent, only the unrelated request is left
+	waitFor(t, 5*time.Second, func() bool {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		return len(s.requests) == 1
+	})
+	if tun.ActiveRequests() != 1 {
+		t.Fatalf("%d active requests, expect 1", tun.ActiveRequests())
+	}
+}
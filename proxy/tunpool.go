@@ -1,7 +1,6 @@
 package proxy
 
 import (
-	"math"
 	"sort"
 	"sync"
 	"time"
@@ -18,10 +17,13 @@ type TunPool struct {
 
 	tunSelector selector.TunSelector
 	tm          *TunMgr
+	// breakers back off the dials of the failing nodes
+	breakers *breakers
 }
 
 func newTunPool(tunCount, tunCap int, tunSelector selector.TunSelector, tm *TunMgr) *TunPool {
-	return &TunPool{tunCount: tunCount, tunCap: tunCap, tunLock: sync.Mutex{}, tunSelector: tunSelector, tm: tm}
+	breakers := newBreakers(tm.opts.backoff)
+	return &TunPool{tunCount: tunCount, tunCap: tunCap, tunLock: sync.Mutex{}, tunSelector: tunSelector, tm: tm, breakers: breakers}
 }
 
 func (tp *TunPool) startup() {
@@ -30,70 +32,95 @@ func (tp *TunPool) startup() {
 		panic("Can not get tun")
 	}
 	for _, tunInfo := range tunInfos {
-		tunnel, err := newTunnel(uuid.NewString(), tp.tm, tp.tunCap, tunInfo)
+		tunnel, err := tp.dial(tunInfo)
 		if err != nil {
 			log.Errorf("new Tunnel failed %s", err.Error())
 			continue
 		}
-		tp.tunnels = append(tp.tunnels, tunnel)
+		tp.add(tunnel)
 	}
 
-	if len(tp.tunnels) == 0 {
+	tunnels := tp.getTunnels()
+	if len(tunnels) == 0 {
 		panic("No available tun exist")
 	}
 
-	log.Infof("startup tunnels len %d", len(tp.tunnels))
+	log.Infof("startup tunnels len %d", len(tunnels))
 
 	go tp.keepalive()
-	// go tp.sortTunnels()
+	go tp.sortTunnels()
 	go tp.refresh()
 
 }
 
-func (tp *TunPool) allocTunnelForRequest() *Tunnel {
+// allocTunnelForRequest pick a tunnel by the balancer, the tunnels in exclude are skipped
+func (tp *TunPool) allocTunnelForRequest(exclude map[*Tunnel]bool) *Tunnel {
 	tp.tunLock.Lock()
 	defer tp.tunLock.Unlock()
 
-	if len(tp.tunnels) > 0 {
-		return tp.tunnels[0]
+	// skip the tunnels which can not take a request
+	eligible := make([]*Tunnel, 0, len(tp.tunnels))
+	for _, tun := range tp.tunnels {
+		if tun.isConnected() && !tun.isFulled() && !exclude[tun] {
+			eligible = append(eligible, tun)
+		}
 	}
-	return nil
+
+	if len(eligible) == 0 {
+		return nil
+	}
+	return tp.tm.opts.balancer.Pick(eligible)
 }
 
 func (tp *TunPool) addTunnels() {
 
 	tunInfos := tp.tunSelector.GetTunInfos(tp.tunCount)
 	// filter tun
-	tp.tunLock.Lock()
-	defer tp.tunLock.Unlock()
-
+	tunnels := tp.getTunnels()
 	tunMap := make(map[string]*Tunnel)
-	for _, tun := range tp.tunnels {
+	for _, tun := range tunnels {
 		tunMap[tun.targetNodeID] = tun
 	}
 
+	// skip the nodes in the pool, and the nodes whose circuit is open
+	now := time.Now()
 	availableTunInfos := make([]*selector.TunInfo, 0)
 	for _, tunInfo := range tunInfos {
-		if _, ok := tunMap[tunInfo.NodeID]; !ok {
+		if _, ok := tunMap[tunInfo.NodeID]; !ok && tp.breakers.allow(tunInfo.NodeID, now) {
 			availableTunInfos = append(availableTunInfos, tunInfo)
 		}
 	}
 
-	log.Debugf("filter availableTunInfos len %d, tunInfos len %d, tun len %d", len(availableTunInfos), len(tunInfos), len(tp.tunnels))
+	log.Debugf("filter availableTunInfos len %d, tunInfos len %d, tun len %d", len(availableTunInfos), len(tunInfos), len(tunnels))
 	for _, tunInfo := range availableTunInfos {
-		tunnel, err := newTunnel(uuid.NewString(), tp.tm, tp.tunCap, tunInfo)
+		tunnel, err := tp.dial(tunInfo)
 		if err != nil {
 			log.Errorf("New tunnel failed %s", err.Error())
 			continue
 		}
 
-		tp.tunnels = append(tp.tunnels, tunnel)
-		if len(tp.tunnels) >= tp.tunCount {
+		if !tp.add(tunnel) {
 			break
 		}
 	}
 }
 
+// add append the tunnel to the pool and then start serving it, so a broken tunnel
+// is always in the pool when it's reported. The tunnel is destroyed if the pool is full
+func (tp *TunPool) add(tun *Tunnel) bool {
+	tp.tunLock.Lock()
+	if len(tp.tunnels) >= tp.tunCount {
+		tp.tunLock.Unlock()
+		tun.destroy()
+		return false
+	}
+	tp.tunnels = append(tp.tunnels, tun)
+	tp.tunLock.Unlock()
+
+	go tun.serveWebsocket()
+	return true
+}
+
 func (tp *TunPool) rmeoveTunnel(tun *Tunnel) {
 	tp.tunLock.Lock()
 	defer tp.tunLock.Unlock()
@@ -101,20 +128,87 @@ func (tp *TunPool) rmeoveTunnel(tun *Tunnel) {
 	for i, t := range tp.tunnels {
 		if t.uuid == tun.uuid {
 			tp.tunnels = append(tp.tunnels[:i], tp.tunnels[i+1:]...)
+			return
+		}
+	}
+}
+
+// dial create a tunnel to the node and record the result in its breaker
+func (tp *TunPool) dial(tunInfo *selector.TunInfo) (*Tunnel, error) {
+	tunnel, err := newTunnel(uuid.NewString(), tp.tm, tp.tunCap, tunInfo)
+	if err != nil {
+		tp.breakers.onFailure(tunInfo.NodeID, time.Now())
+		return nil, err
+	}
+
+	tp.breakers.onSuccess(tunInfo.NodeID, time.Now())
+	return tunnel, nil
+}
+
+func (tp *TunPool) contains(tun *Tunnel) bool {
+	tp.tunLock.Lock()
+	defer tp.tunLock.Unlock()
+
+	for _, t := range tp.tunnels {
+		if t == tun {
+			return true
 		}
 	}
+	return false
 }
 
+// onTunnelBroken keep the tunnel in the pool and reconnect it with backoff,
+// the balancers skip it until it's connected again
 func (tp *TunPool) onTunnelBroken(tun *Tunnel) {
-	log.Infof("onTunnelBroken %s", tun.uuid)
-	tp.rmeoveTunnel(tun)
+	log.Infof("onTunnelBroken %s node %s", tun.uuid, tun.targetNodeID)
+	if tun.isDestroyed() || !tp.contains(tun) {
+		tp.rmeoveTunnel(tun)
+		return
+	}
+
+	tp.breakers.onFailure(tun.targetNodeID, time.Now())
+	go tp.reconnect(tun)
+}
+
+// reconnect dial the node of tun until it succeed, the tunnel is dropped from the pool
+// after maxReconnectFailures consecutive failures, so refresh can replace it
+func (tp *TunPool) reconnect(tun *Tunnel) {
+	nodeID := tun.targetNodeID
+	for {
+		time.Sleep(tp.breakers.retryAfter(nodeID, time.Now()))
+
+		if tun.isDestroyed() || !tp.contains(tun) {
+			return
+		}
+
+		if !tp.breakers.allow(nodeID, time.Now()) {
+			// another dial is probing the node
+			time.Sleep(tp.tm.opts.backoff.base)
+			continue
+		}
+
+		err := tun.reconnect()
+		if err == nil {
+			tp.breakers.onSuccess(nodeID, time.Now())
+			log.Infof("reconnect tunnel %s node %s", tun.uuid, nodeID)
+			return
+		}
+
+		failures := tp.breakers.onFailure(nodeID, time.Now())
+		log.Errorf("reconnect tunnel %s node %s failed %s, %d failures", tun.uuid, nodeID, err.Error(), failures)
+		if failures >= maxReconnectFailures {
+			log.Warnf("drop tunnel %s node %s", tun.uuid, nodeID)
+			tp.rmeoveTunnel(tun)
+			return
+		}
+	}
 }
 
 func (tp *TunPool) refresh() {
 	ticker := time.NewTicker(keepaliveIntervel)
 	for {
 		<-ticker.C
-		if len(tp.tunnels) < tp.tunCount {
+		if len(tp.getTunnels()) < tp.tunCount {
 			tp.addTunnels()
 		}
 	}
@@ -125,47 +219,76 @@ func (tp *TunPool) keepalive() {
 
 	for {
 		<-ticker.C
-		for _, t := range tp.tunnels {
+		tunnels := tp.getTunnels()
+		for _, t := range tunnels {
 			t.sendPing()
 		}
 
-		// Disposal of dead tunnels
-		for _, t := range tp.tunnels {
-			if time.Since(t.lastPongTime) > 3*keepaliveIntervel {
-				tp.onTunnelBroken(t)
+		// break the dead tunnels, they are reconnected by onTunnelBroken
+		for _, t := range tunnels {
+			if t.isConnected() && time.Since(t.latency.lastPongTime()) > 3*keepaliveIntervel {
+				t.breakConn()
 			}
 		}
 	}
 }
 
+// sortTunnels rank the tunnels by latency periodically,
+// so the balancers which break ties by order prefer the fastest tunnel
 func (tp *TunPool) sortTunnels() {
 	ticker := time.NewTicker(sortIntervel)
 
 	for {
 		<-ticker.C
-
-		sort.Slice(tp.tunnels, func(i, j int) bool {
-			return delayAverage(tp.tunnels[i].delays) < delayAverage(tp.tunnels[j].delays)
-		})
+		tp.rankTunnels()
 	}
+}
 
+func (tp *TunPool) rankTunnels() {
+	tp.tunLock.Lock()
+	defer tp.tunLock.Unlock()
+
+	sortByLatency(tp.tunnels)
 }
 
-func delayAverage(delays []int) int {
-	if len(delays) == 0 {
-		return math.MaxInt
+// sortByLatency sort tunnels by the moving average of latency, the tunnels without pong go last
+func sortByLatency(tunnels []*Tunnel) {
+	latencies := make(map[*Tunnel]time.Duration, len(tunnels))
+	for _, tun := range tunnels {
+		latencies[tun] = tun.Latency()
 	}
 
-	count := 0
-	for _, delay := range delays {
-		count += delay
-	}
+	sort.SliceStable(tunnels, func(i, j int) bool {
+		li, lj := latencies[tunnels[i]], latencies[tunnels[j]]
+		if li == 0 || lj == 0 {
+			return lj == 0 && li != 0
+		}
+		return li < lj
+	})
+}
+
+// getTunnels returns a copy of the tunnels
+func (tp *TunPool) getTunnels() []*Tunnel {
+	tp.tunLock.Lock()
+	defer tp.tunLock.Unlock()
 
-	return count / len(delays)
+	return append([]*Tunnel(nil), tp.tunnels...)
+}
+
+// stats returns the stats of the tunnels ranked by latency
+func (tp *TunPool) stats() []TunnelStats {
+	tunnels := tp.getTunnels()
+	sortByLatency(tunnels)
+
+	stats := make([]TunnelStats, 0, len(tunnels))
+	for _, tun := range tunnels {
+		stats = append(stats, tun.Stats())
+	}
+	return stats
 }
 
 func (tp *TunPool) reset(tunInfo *selector.TunInfo) error {
-	for _, t := range tp.tunnels {
+	for _, t := range tp.getTunnels() {
 		tp.rmeoveTunnel(t)
 	}
 
@@ -173,7 +296,7 @@ func (tp *TunPool) reset(tunInfo *selector.TunInfo) error {
 	if err != nil {
 		return err
 	}
-	tp.tunnels = append(tp.tunnels, tunnel)
+	tp.add(tunnel)
 
 	return nil
 }
@@ -0,0 +1,212 @@
+package worker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy decide whether and when a failed api call is sent again.
+// CreateProject is not idempotent, it is retried only when the request
+// could not reach the api server, unless RetryNonIdempotent is set
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts of a call, 1 disable retry
+	MaxAttempts int
+	// InitialBackoff is the wait before the second attempt
+	InitialBackoff time.Duration
+	// MaxBackoff bound the wait between two attempts
+	MaxBackoff time.Duration
+	// MaxRetryAfter bound the wait asked by the Retry-After header of a response,
+	// the call gives up if the server asks to wait longer. 0 means MaxBackoff
+	MaxRetryAfter time.Duration
+	// Multiplier grow the wait after each attempt
+	Multiplier float64
+	// Jitter randomize each wait by up to this fraction, 0.2 means ±20%
+	Jitter float64
+	// Retryable report whether the error of an attempt is transient,
+	// nil means IsRetryable
+	Retryable func(err error) bool
+	// RetryNonIdempotent retry CreateProject like the other calls
+	RetryNonIdempotent bool
+}
+
+// DefaultRetryPolicy try a call 3 times, waiting about 0.5s and 1s between the attempts
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		MaxRetryAfter:  time.Minute,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// NoRetry send every call only once
+func NoRetry() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 1}
+}
+
+// WithRetryPolicy replace DefaultRetryPolicy
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *options) error {
+		if policy.MaxAttempts < 1 {
+			return fmt.Errorf("retry policy MaxAttempts must be at least 1")
+		}
+		if policy.Jitter < 0 || policy.Jitter > 1 {
+			return fmt.Errorf("retry policy Jitter must be between 0 and 1")
+		}
+		o.retryPolicy = policy
+		return nil
+	}
+}
+
+// IsRetryable report whether err is a transient failure: timeouts of a single request,
+// refused or reset connections, truncated responses, 5xx and rate limited responses.
+// Certificate and tls errors, invalid urls and the other errors are permanent
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= http.StatusInternalServerError || errors.Is(apiErr, ErrRateLimited)
+	}
+
+	if isTLSError(err) {
+		return false
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func isTLSError(err error) bool {
+	var certErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	var headerErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	return errors.As(err, &certErr) || errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) ||
+		errors.As(err, &invalidErr) || errors.As(err, &headerErr) || errors.As(err, &alertErr)
+}
+
+// parseRetryAfter parse the Retry-After header, in seconds or an http date, 0 if it's not set or invalid
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if len(value) == 0 {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		return 0
+	}
+
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// isNotSent report whether err happened before the request reach the api server,
+// so that a non-idempotent request can be sent again safely
+func isNotSent(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+func (p *RetryPolicy) shouldRetry(err error, idempotent bool) bool {
+	if !idempotent && !p.RetryNonIdempotent && !isNotSent(err) {
+		return false
+	}
+
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// backoff returns the wait before the attempt, attempt start from 1
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	wait := float64(p.InitialBackoff)
+	for i := 1; i < attempt-1; i++ {
+		wait = wait * p.Multiplier
+		if p.MaxBackoff > 0 && wait > float64(p.MaxBackoff) {
+			break
+		}
+	}
+
+	if p.MaxBackoff > 0 && wait > float64(p.MaxBackoff) {
+		wait = float64(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		wait = wait * (1 + p.Jitter*(2*rand.Float64()-1))
+	}
+	return time.Duration(wait)
+}
+
+// maxRetryAfter returns the longest wait asked by Retry-After to honor, 0 means no bound
+func (p *RetryPolicy) maxRetryAfter() time.Duration {
+	if p.MaxRetryAfter > 0 {
+		return p.MaxRetryAfter
+	}
+	return p.MaxBackoff
+}
+
+// retry call fn until it succeeds, returns an error the policy does not retry,
+// or MaxAttempts is reached
+func (p *RetryPolicy) retry(ctx context.Context, idempotent bool, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+
+		if attempt >= p.MaxAttempts || ctx.Err() != nil || !p.shouldRetry(err, idempotent) {
+			return err
+		}
+
+		wait := p.backoff(attempt + 1)
+		// the server asks to wait
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			if maxRetryAfter := p.maxRetryAfter(); maxRetryAfter > 0 && apiErr.RetryAfter > maxRetryAfter {
+				log.Warnf("attempt %d failed %s, give up as asked to retry after %s", attempt, err.Error(), apiErr.RetryAfter)
+				return err
+			}
+			wait = apiErr.RetryAfter
+		}
+		log.Warnf("attempt %d failed %s, retry after %s", attempt, err.Error(), wait)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -20,20 +20,11 @@ type AutoSelector struct {
 }
 
 func NewAutoSelector(w worker.Worker, areaID string) (*AutoSelector, error) {
-	page := 0
-	size := 50
-	pInfos := make([]*worker.PorjectInfo, 0)
-	for {
-		projectInfos, err := w.LoadProjects(page, size)
-		if err != nil {
-			return nil, err
-		}
-
-		pInfos = append(pInfos, projectInfos...)
-		if len(projectInfos) < size {
-			break
-		}
-		page++
+	pInfos, err := worker.NewProjectInfoIterator(w, 50).All(context.Background())
+	if worker.IsPartial(err) {
+		log.Warnf("load projects: %s", err.Error())
+	} else if err != nil {
+		return nil, err
 	}
 
 	return &AutoSelector{worker: w, projectInfos: pInfos, areaID: areaID}, nil
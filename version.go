@@ -0,0 +1,99 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxVersionComponent is the max of major, minor and patch, each one is packed in 8 bits
+const maxVersionComponent = 255
+
+// Version is the version of a project bundle, major, minor and patch are packed
+// as major<<16 | minor<<8 | patch, which is the version int of the api
+type Version uint32
+
+// NewVersion returns an error if a component is out of 0-255
+func NewVersion(major, minor, patch int) (Version, error) {
+	for _, c := range []int{major, minor, patch} {
+		if c < 0 || c > maxVersionComponent {
+			return 0, fmt.Errorf("invalid version %d.%d.%d, component must be in 0-%d", major, minor, patch, maxVersionComponent)
+		}
+	}
+	return Version(major<<16 | minor<<8 | patch), nil
+}
+
+// ParseVersion parse a version like "1.2.3"
+func ParseVersion(s string) (Version, error) {
+	vers := strings.Split(s, ".")
+	if len(vers) != 3 {
+		return 0, fmt.Errorf("invalid version %s", s)
+	}
+
+	components := make([]int, 0, len(vers))
+	for i, name := range []string{"major", "minor", "patch"} {
+		c, err := strconv.Atoi(vers[i])
+		if err != nil {
+			return 0, fmt.Errorf("parse version %s %s failed %s", name, vers[i], err.Error())
+		}
+		components = append(components, c)
+	}
+	return NewVersion(components[0], components[1], components[2])
+}
+
+func (v Version) Major() int {
+	return int(v>>16) & 0xff
+}
+
+func (v Version) Minor() int {
+	return int(v>>8) & 0xff
+}
+
+func (v Version) Patch() int {
+	return int(v) & 0xff
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major(), v.Minor(), v.Patch())
+}
+
+// Compare returns -1, 0 or 1 if v is older than, equal to or newer than o
+func (v Version) Compare(o Version) int {
+	switch {
+	case v < o:
+		return -1
+	case v > o:
+		return 1
+	}
+	return 0
+}
+
+// MarshalJSON encode the version as the packed int of the api
+func (v Version) MarshalJSON() ([]byte, error) {
+	return json.Marshal(uint32(v))
+}
+
+// UnmarshalJSON accept the packed int or a string like "1.2.3"
+func (v *Version) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		ver, err := ParseVersion(s)
+		if err != nil {
+			return err
+		}
+		*v = ver
+		return nil
+	}
+
+	var n uint32
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("invalid version %s", string(data))
+	}
+
+	if n > 0xffffff {
+		return fmt.Errorf("invalid version %d, component must be in 0-%d", n, maxVersionComponent)
+	}
+	*v = Version(n)
+	return nil
+}
@@ -0,0 +1,64 @@
+package worker_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	worker "github.com/zscboy/titan-workers-sdk"
+)
+
+func TestParseVersion(t *testing.T) {
+	v, err := worker.ParseVersion("1.2.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v != 1<<16|2<<8|3 || v.String() != "1.2.3" {
+		t.Fatalf("version %d %s", v, v.String())
+	}
+
+	for _, s := range []string{"", "1.2", "1.2.3.4", "a.b.c", "256.0.0", "1.256.0", "1.2.256", "-1.0.0"} {
+		if _, err := worker.ParseVersion(s); err == nil {
+			t.Fatalf("ParseVersion(%q) should fail", s)
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	older, _ := worker.ParseVersion("1.9.255")
+	newer, _ := worker.ParseVersion("2.0.0")
+
+	if older.Compare(newer) != -1 || newer.Compare(older) != 1 || newer.Compare(newer) != 0 {
+		t.Fatal("compare versions")
+	}
+}
+
+func TestVersionJSON(t *testing.T) {
+	v, _ := worker.ParseVersion("1.2.3")
+	buf, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(buf) != "66051" {
+		t.Fatalf("marshal version %s", string(buf))
+	}
+
+	for _, data := range []string{"66051", `"1.2.3"`} {
+		var got worker.Version
+		if err := json.Unmarshal([]byte(data), &got); err != nil {
+			t.Fatal(err)
+		}
+
+		if got != v {
+			t.Fatalf("unmarshal %s = %s", data, got.String())
+		}
+	}
+
+	for _, data := range []string{"16777216", `"1.2.300"`, "true"} {
+		var got worker.Version
+		if err := json.Unmarshal([]byte(data), &got); err == nil {
+			t.Fatalf("unmarshal %s should fail", data)
+		}
+	}
+}
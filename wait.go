@@ -0,0 +1,130 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultWaitInterval = 5 * time.Second
+
+	nodeStatusNotReported NodeStatus = -1
+)
+
+// NodeTransition is a change of the status of a node seen by WaitForProjectReady.
+// From is -1 the first time the node is seen
+type NodeTransition struct {
+	NodeID string
+	From   NodeStatus
+	To     NodeStatus
+	Node   *Node
+}
+
+// WaitOptions control WaitForProjectReady, the deadline is the deadline of its context
+type WaitOptions struct {
+	// Replicas is the count of started nodes to wait for, 0 means the replicas of the project
+	Replicas int
+	// Interval between two polls, 0 means 5 seconds
+	Interval time.Duration
+	// OnTransition is called for each node whose status changed since the last poll
+	OnTransition func(NodeTransition)
+	// OnProgress is called after each poll with the count of started nodes
+	OnProgress func(started, replicas int)
+	// Condition is an extra check of the project info, e.g. the expected bundle,
+	// the project is ready only when it returns true
+	Condition func(info *PorjectInfo) bool
+	// StaleNodes are the ids of the nodes started before a change of the project, e.g. a new bundle.
+	// They are counted only once seen leaving the started status and started again, as restarted
+	// nodes run the change. A restart between two polls is not seen
+	StaleNodes []string
+}
+
+// WaitForProjectReady poll GetProjectInfo until the project has enough started nodes
+// with a websocket url, and returns the last info. If ctx is done first, it returns
+// the last info and an error wrapping the error of ctx.
+// A project not found yet and transient errors are polled again
+func WaitForProjectReady(ctx context.Context, w Worker, projectID string, opts WaitOptions) (*PorjectInfo, error) {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = defaultWaitInterval
+	}
+
+	statuses := make(map[string]NodeStatus)
+	stale := make(map[string]bool)
+	for _, id := range opts.StaleNodes {
+		stale[id] = true
+	}
+
+	var info *PorjectInfo
+	started, replicas := 0, opts.Replicas
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		pInfo, err := w.GetProjectInfoCtx(ctx, projectID)
+		if err == nil {
+			info = pInfo
+			reportTransitions(info, statuses, opts.OnTransition)
+			started, replicas = countStarted(info, opts.Replicas, stale)
+
+			if opts.OnProgress != nil {
+				opts.OnProgress(started, replicas)
+			}
+
+			if replicas > 0 && started >= replicas && (opts.Condition == nil || opts.Condition(info)) {
+				return info, nil
+			}
+		} else if ctx.Err() == nil && !errors.Is(err, ErrNotFound) && !IsRetryable(err) {
+			return info, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return info, fmt.Errorf("project %s %d of %d replicas started: %w", projectID, started, replicas, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// countStarted returns the count of serving nodes which are not stale, the stale
+// nodes seen not started are removed from stale as they will start with the change
+func countStarted(info *PorjectInfo, replicas int, stale map[string]bool) (int, int) {
+	if replicas <= 0 {
+		replicas = info.Replicas
+	}
+
+	for _, node := range info.Nodes {
+		if node.Status != NodeStatusStarted {
+			delete(stale, node.ID)
+		}
+	}
+
+	started := 0
+	for _, node := range info.ServingNodes() {
+		if !stale[node.ID] {
+			started++
+		}
+	}
+	return started, replicas
+}
+
+func reportTransitions(info *PorjectInfo, statuses map[string]NodeStatus, onTransition func(NodeTransition)) {
+	for _, node := range info.Nodes {
+		from, ok := statuses[node.ID]
+		if !ok {
+			from = nodeStatusNotReported
+		}
+
+		if from == node.Status {
+			continue
+		}
+
+		statuses[node.ID] = node.Status
+		if onTransition != nil {
+			onTransition(NodeTransition{NodeID: node.ID, From: from, To: node.Status, Node: node})
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package worker_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	worker "github.com/zscboy/titan-workers-sdk"
+	"github.com/zscboy/titan-workers-sdk/workertest"
+)
+
+func TestWaitForProjectReady(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	w := newTestWorker(t, s)
+	id := s.AddProject(&worker.PorjectInfo{Name: "wait", Replicas: 2, Nodes: []*worker.Node{{ID: "e_1"}, {ID: "e_2"}}}, "china")
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		s.SetNodeStatus(id, "e_1", worker.NodeStatusFailed)
+		time.Sleep(20 * time.Millisecond)
+		s.StartNodes(id)
+	}()
+
+	lock := sync.Mutex{}
+	transitions := make([]worker.NodeTransition, 0)
+	opts := worker.WaitOptions{
+		Interval: 5 * time.Millisecond,
+		OnTransition: func(t worker.NodeTransition) {
+			lock.Lock()
+			transitions = append(transitions, t)
+			lock.Unlock()
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	info, err := worker.WaitForProjectReady(ctx, w, id, opts)
+	if err != nil {
+		t.Fatalf("WaitForProjectReady %s", err.Error())
+	}
+
+	if info.Nodes[0].Status != worker.NodeStatusStarted || info.Nodes[1].Status != worker.NodeStatusStarted {
+		t.Fatalf("nodes not started %#v", info.Nodes)
+	}
+
+	// each node is reported when first seen and when started
+	seen := make(map[string]int)
+	for _, transition := range transitions {
+		if transition.From == -1 || transition.To == 1 {
+			seen[transition.NodeID]++
+		}
+	}
+
+	if seen["e_1"] != 2 || seen["e_2"] != 2 {
+		t.Fatalf("unexpected transitions %#v", transitions)
+	}
+}
+
+func TestWaitForProjectReadyTimeout(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	w := newTestWorker(t, s)
+	id := s.AddProject(&worker.PorjectInfo{Name: "wait", Replicas: 1, Nodes: []*worker.Node{{ID: "e_1"}}}, "china")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := worker.WaitForProjectReady(ctx, w, id, worker.WaitOptions{Interval: 5 * time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitForProjectReady error %v, expect DeadlineExceeded", err)
+	}
+}
+
+func TestWaitForProjectReadyStaleNodes(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	w := newTestWorker(t, s)
+	id := addProject(s, "stale", 2)
+	info := s.ProjectInfo(id)
+
+	var lock sync.Mutex
+	restarted := false
+	go func() {
+		for _, node := range info.Nodes {
+			time.Sleep(20 * time.Millisecond)
+			s.SetNodeStatus(id, node.ID, worker.NodeStatusStarting)
+			time.Sleep(20 * time.Millisecond)
+			if node == info.Nodes[len(info.Nodes)-1] {
+				lock.Lock()
+				restarted = true
+				lock.Unlock()
+			}
+			s.SetNodeStatus(id, node.ID, worker.NodeStatusStarted)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := worker.WaitOptions{Interval: 5 * time.Millisecond, StaleNodes: []string{info.Nodes[0].ID, info.Nodes[1].ID}}
+	if _, err := worker.WaitForProjectReady(ctx, w, id, opts); err != nil {
+		t.Fatalf("WaitForProjectReady %s", err.Error())
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if !restarted {
+		t.Fatalf("WaitForProjectReady returns before the stale nodes restarted")
+	}
+}
@@ -50,7 +50,7 @@ func NewWeb(pInfos []*worker.PorjectInfo, currentNode *worker.Node) *Web {
 	areas := make(Areas)
 	for _, pInfo := range pInfos {
 		for _, node := range pInfo.Nodes {
-			if node.Status != 1 {
+			if node.Status != worker.NodeStatusStarted {
 				continue
 			}
 
@@ -2,11 +2,34 @@ package worker
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+)
+
+var log = logging.Logger("worker")
+
+const (
+	// login again if the token will expire within tokenRefreshMargin
+	tokenRefreshMargin = 1 * time.Minute
+	// the codes api server return when the jwt token is invalid or expired,
+	// when the resource does not exist and when the caller is throttled
+	codeUnauthorized = 401
+	codeNotFound     = 404
+	codeRateLimited  = 429
+	// timeout of a single http request if the caller's context has no deadline
+	defaultRequestTimeout = 30 * time.Second
+	// count of projects per page of the iterators
+	defaultPageSize = 50
+	// max count of concurrent GetProjectInfo when loading projects
+	defaultConcurrency = 8
 )
 
 type Area struct {
@@ -20,20 +43,43 @@ type AreaList struct {
 }
 
 type Node struct {
-	ID     string `json:"NodeID"`
-	URL    string `json:"WsURL"`
-	Status int    `json:"status"`
-	AreaID string `json:"GeoID"`
-	IP     string `json:"IP"`
+	ID     string     `json:"NodeID"`
+	URL    string     `json:"WsURL"`
+	Status NodeStatus `json:"status"`
+	AreaID string     `json:"GeoID"`
+	IP     string     `json:"IP"`
+}
+
+// RegionNode is a node of a region, the capacity fields are 0
+// if the api server does not report them
+type RegionNode struct {
+	ID        string     `json:"NodeID"`
+	IP        string     `json:"IP"`
+	AreaID    string     `json:"AreaID"`
+	Status    NodeStatus `json:"Status"`
+	CPUCores  int        `json:"CPUCores"`
+	Memory    int64      `json:"Memory"`
+	DiskSpace int64      `json:"DiskSpace"`
+}
+
+// RegionNodeList is a page of nodes, Total is the count of all pages
+type RegionNodeList struct {
+	Total int           `json:"total"`
+	List  []*RegionNode `json:"list"`
 }
 
 type PorjectInfo struct {
-	ID        string  `json:"UUID"`
-	Name      string  `json:"Name"`
-	BundleURL string  `json:"BundleURL"`
-	AreaID    string  `json:"AreaID"`
-	Replicas  int     `json:"Replicas"`
-	Nodes     []*Node `json:"DetailsList"`
+	ID        string `json:"UUID"`
+	Name      string `json:"Name"`
+	BundleURL string `json:"BundleURL"`
+	AreaID    string `json:"AreaID"`
+	Replicas  int    `json:"Replicas"`
+	// Expiration is in ExpirationLayout, see ExpireTime
+	Expiration string  `json:"Expiration"`
+	Version    Version `json:"Version"`
+	Nodes      []*Node `json:"DetailsList"`
+	// Account is the name of the account of the project, set by MultiWorker
+	Account string `json:"account,omitempty"`
 }
 
 type ProjectBase struct {
@@ -47,21 +93,33 @@ type Project struct {
 	Status string `json:"status"`
 	AreaID string `json:"area_id"`
 	Region string `json:"region"`
+	// Expiration is in ExpirationLayout, see ExpireTime
+	Expiration string  `json:"expiration"`
+	Version    Version `json:"version"`
+	// CreatedTime is in ExpirationLayout, see CreateTime
+	CreatedTime string `json:"created_time"`
+	// Account is the name of the account of the project, set by MultiWorker
+	Account string `json:"account,omitempty"`
 	ProjectBase
 }
 
 type ReqCreateProject struct {
 	ProjectBase
-	Region     string `json:"region"`
-	NodeIDs    string `json:"node_ids"`
-	AreaID     string `json:"area_id"`
-	Expiration string `json:"expiration"`
-	Version    int    `json:"version"`
+	Region     string  `json:"region"`
+	NodeIDs    string  `json:"node_ids"`
+	AreaID     string  `json:"area_id"`
+	Expiration string  `json:"expiration"`
+	Version    Version `json:"version"`
+	// Account is the name of the account to create the project with MultiWorker,
+	// empty for the first account
+	Account string `json:"-"`
 }
 
 type ReqUpdatePorjct struct {
 	ID string `json:"project_id"`
 	ProjectBase
+	// Expiration is optional, in ExpirationLayout, empty to keep the current one
+	Expiration string `json:"expiration,omitempty"`
 }
 
 type Tunnel struct {
@@ -92,20 +150,49 @@ type Worker interface {
 	GetProjectInfo(projectID string) (*PorjectInfo, error)
 	// area is asia,americas,europe,africa,oceania
 	GetRegions(area string) (*AreaList, error)
-	ListNodesWithRegions(areaID string, region string) ([]string, error)
+	// list the nodes of the region which a project can deploy on, page start from 0
+	ListNodesWithRegions(areaID string, region string, page, size int) (*RegionNodeList, error)
 	GetTunnels(projectID string) ([]*Tunnel, error)
 
+	// LoadProjects returns the projects of the page which have serving nodes, with only those nodes.
+	// If the infos of some projects fail to load, the others are returned with ProjectErrors
 	LoadProjects(page, size int) ([]*PorjectInfo, error)
+
+	// The Ctx variants cancel the call when ctx is done, and use the deadline of ctx
+	// for the http requests. Without ctx, every request times out after WithTimeout(30s by default)
+	UpldateProjectCtx(ctx context.Context, req *ReqUpdatePorjct) error
+	CreateProjectCtx(ctx context.Context, req *ReqCreateProject) error
+	GetProjectsCtx(ctx context.Context, page, size int) ([]*Project, error)
+	DeleteProjectCtx(ctx context.Context, projectID string) error
+	GetProjectInfoCtx(ctx context.Context, projectID string) (*PorjectInfo, error)
+	GetRegionsCtx(ctx context.Context, area string) (*AreaList, error)
+	ListNodesWithRegionsCtx(ctx context.Context, areaID string, region string, page, size int) (*RegionNodeList, error)
+	GetTunnelsCtx(ctx context.Context, projectID string) ([]*Tunnel, error)
+	LoadProjectsCtx(ctx context.Context, page, size int) ([]*PorjectInfo, error)
 }
 
-func NewWorker(cfg *Config) (Worker, error) {
+func NewWorker(cfg *Config, opts ...Option) (Worker, error) {
 	if len(cfg.UserName) == 0 || len(cfg.Password) == 0 || len(cfg.APIServer) == 0 {
 		panic("[UserName][Password][APIServer] can not emtpy")
 	}
 
-	w := &worker{config: cfg}
+	o := defaultOptions()
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
 
-	if err := w.login(); err != nil {
+	client, err := o.client()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &worker{config: cfg, userAgent: o.userAgent, timeout: o.timeout, retryPolicy: o.retryPolicy, concurrency: o.concurrency}
+	w.handler = chain(client.Do, o.middlewares)
+
+	ctx := context.Background()
+	if err := w.retryPolicy.retry(ctx, true, func() error { return w.login(ctx) }); err != nil {
 		return nil, err
 	}
 
@@ -114,247 +201,80 @@ func NewWorker(cfg *Config) (Worker, error) {
 
 type worker struct {
 	config *Config
-	token  string
-	expire time.Time
+	// handler send the requests through the middlewares and the http client
+	handler   Handler
+	userAgent string
+	timeout   time.Duration
+
+	retryPolicy RetryPolicy
+	// max count of concurrent GetProjectInfo of LoadProjects
+	concurrency int
+
+	// tokenLock serialize login, so concurrent calls refresh the token only once
+	tokenLock sync.Mutex
+	token     string
+	expire    time.Time
 }
 
 func (w *worker) UpldateProject(reqUpdateProject *ReqUpdatePorjct) error {
-	buf, err := json.Marshal(reqUpdateProject)
-	if err != nil {
-		return err
-	}
-
-	url := fmt.Sprintf("%s/api/v1/project/update", w.config.APIServer)
-	// Create a new HTTP GET request
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(buf))
-	if err != nil {
-		return err
-	}
-
-	// Add custom headers if needed
-	addHeaderToRequest(req, w.token)
-
-	// Send the request
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("status cod %d, %s", resp.StatusCode, string(buf))
-	}
-
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-
-	ret := Result{}
-	err = json.Unmarshal(body, &ret)
-	if err != nil {
-		return err
-	}
-
-	if ret.Code != 0 {
-		return fmt.Errorf(string(body))
-	}
+	return w.UpldateProjectCtx(context.Background(), reqUpdateProject)
+}
 
-	return nil
+func (w *worker) UpldateProjectCtx(ctx context.Context, reqUpdateProject *ReqUpdatePorjct) error {
+	_, err := do[json.RawMessage](ctx, w, "POST", "/api/v1/project/update", reqUpdateProject, true)
+	return err
 }
 
 func (w *worker) CreateProject(reqCreateProject *ReqCreateProject) error {
-	buf, err := json.Marshal(reqCreateProject)
-	if err != nil {
-		return err
-	}
-
-	url := fmt.Sprintf("%s/api/v1/project/create", w.config.APIServer)
-	// Create a new HTTP GET request
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(buf))
-	if err != nil {
-		return err
-	}
-
-	// Add custom headers if needed
-	addHeaderToRequest(req, w.token)
-
-	// Send the request
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("status cod %d, %s", resp.StatusCode, string(buf))
-	}
-
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-
-	ret := Result{}
-	err = json.Unmarshal(body, &ret)
-	if err != nil {
-		return err
-	}
-
-	if ret.Code != 0 {
-		return fmt.Errorf(string(body))
-	}
+	return w.CreateProjectCtx(context.Background(), reqCreateProject)
+}
 
-	return nil
+func (w *worker) CreateProjectCtx(ctx context.Context, reqCreateProject *ReqCreateProject) error {
+	// a repeated create request may deploy the project twice
+	_, err := do[json.RawMessage](ctx, w, "POST", "/api/v1/project/create", reqCreateProject, false)
+	return err
 }
 
 func (w *worker) GetProjects(page, size int) ([]*Project, error) {
-	url := fmt.Sprintf("%s/api/v1/project/list?page=%d&size=%d", w.config.APIServer, page, size)
-	// Create a new HTTP GET request
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Add custom headers if needed
-	addHeaderToRequest(req, w.token)
-
-	// Send the request
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("status cod %d, %s", resp.StatusCode, string(buf))
-	}
-
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
+	return w.GetProjectsCtx(context.Background(), page, size)
+}
 
-	ret := Result{}
-	err = json.Unmarshal(body, &ret)
+func (w *worker) GetProjectsCtx(ctx context.Context, page, size int) ([]*Project, error) {
+	path := fmt.Sprintf("/api/v1/project/list?page=%d&size=%d", page, size)
+	dataList, err := do[struct {
+		List []*Project `json:"list"`
+	}](ctx, w, "GET", path, nil, true)
 	if err != nil {
 		return nil, err
 	}
 
-	if ret.Code != 0 {
-		return nil, fmt.Errorf(ret.Message)
-	}
-
-	// fmt.Println("GetProjects ", string(body))
-
-	dataList := struct {
-		List interface{} `json:"list"`
-	}{}
-
-	if err = interfaceToStruct(ret.Data, &dataList); err != nil {
-		return nil, err
-	}
-
-	projects := make([]*Project, 0)
-	if err = interfaceToStruct(dataList.List, &projects); err != nil {
-		return nil, err
+	if dataList.List == nil {
+		return make([]*Project, 0), nil
 	}
-
-	return projects, nil
+	return dataList.List, nil
 }
 
 func (w *worker) DeleteProject(projectID string) error {
-	url := fmt.Sprintf("%s/api/v1/project/delete?project_id=%s", w.config.APIServer, projectID)
-	// Create a new HTTP GET request
-	req, err := http.NewRequest("POST", url, nil)
-	if err != nil {
-		return err
-	}
-
-	// Add custom headers if needed
-	addHeaderToRequest(req, w.token)
-	// Send the request
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("status cod %d, %s", resp.StatusCode, string(buf))
-	}
-
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-
-	ret := Result{}
-	err = json.Unmarshal(body, &ret)
-	if err != nil {
-		return err
-	}
+	return w.DeleteProjectCtx(context.Background(), projectID)
+}
 
-	if ret.Code != 0 {
-		return fmt.Errorf(ret.Message)
-	}
-	return nil
+func (w *worker) DeleteProjectCtx(ctx context.Context, projectID string) error {
+	path := fmt.Sprintf("/api/v1/project/delete?project_id=%s", projectID)
+	_, err := do[json.RawMessage](ctx, w, "POST", path, nil, true)
+	return err
 }
 
 func (w *worker) GetProjectInfo(projectID string) (*PorjectInfo, error) {
-	url := fmt.Sprintf("%s/api/v1/project/info?project_id=%s", w.config.APIServer, projectID)
-	// Create a new HTTP GET request
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Add custom headers if needed
-	addHeaderToRequest(req, w.token)
-
-	// Send the request
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("status cod %d, %s", resp.StatusCode, string(buf))
-	}
-
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	// fmt.Println("GetProjectInfo ", string(body))
+	return w.GetProjectInfoCtx(context.Background(), projectID)
+}
 
-	ret := Result{}
-	err = json.Unmarshal(body, &ret)
+func (w *worker) GetProjectInfoCtx(ctx context.Context, projectID string) (*PorjectInfo, error) {
+	path := fmt.Sprintf("/api/v1/project/info?project_id=%s", projectID)
+	pinfos, err := do[[]*PorjectInfo](ctx, w, "GET", path, nil, true)
 	if err != nil {
 		return nil, err
 	}
 
-	if ret.Code != 0 {
-		return nil, fmt.Errorf(ret.Message)
-	}
-
-	pinfos := make([]*PorjectInfo, 0)
-	if err := interfaceToStruct(ret.Data, &pinfos); err != nil {
-		return nil, err
-	}
-
 	var projectInfo *PorjectInfo = nil
 	for _, pinfo := range pinfos {
 		if projectInfo == nil {
@@ -364,157 +284,219 @@ func (w *worker) GetProjectInfo(projectID string) (*PorjectInfo, error) {
 		}
 	}
 
+	if projectInfo == nil {
+		return nil, &APIError{Endpoint: "/api/v1/project/info", StatusCode: http.StatusOK, Code: codeNotFound, Message: fmt.Sprintf("project %s not found", projectID)}
+	}
+
 	return projectInfo, nil
 }
 
 func (w *worker) GetRegions(area string) (*AreaList, error) {
-	url := fmt.Sprintf("%s/api/v1/project/regions?region=%s", w.config.APIServer, area)
-	// Create a new HTTP GET request
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Add custom headers if needed
-	addHeaderToRequest(req, w.token)
+	return w.GetRegionsCtx(context.Background(), area)
+}
 
-	// Send the request
-	resp, err := http.DefaultClient.Do(req)
+func (w *worker) GetRegionsCtx(ctx context.Context, area string) (*AreaList, error) {
+	path := fmt.Sprintf("/api/v1/project/regions?region=%s", area)
+	areaList, err := do[*AreaList](ctx, w, "GET", path, nil, true)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("status code %d, %s", resp.StatusCode, string(buf))
+	if areaList == nil {
+		return &AreaList{}, nil
 	}
+	return areaList, nil
+}
 
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
+func (w *worker) ListNodesWithRegions(areaID string, region string, page, size int) (*RegionNodeList, error) {
+	return w.ListNodesWithRegionsCtx(context.Background(), areaID, region, page, size)
+}
 
-	ret := Result{}
-	err = json.Unmarshal(body, &ret)
+func (w *worker) ListNodesWithRegionsCtx(ctx context.Context, areaID string, region string, page, size int) (*RegionNodeList, error) {
+	path := fmt.Sprintf("/api/v1/project/region/nodes?area_id=%s&region=%s&page=%d&size=%d", areaID, region, page, size)
+	nodeList, err := do[*RegionNodeList](ctx, w, "GET", path, nil, true)
 	if err != nil {
 		return nil, err
 	}
 
-	if ret.Code != 0 {
-		return nil, fmt.Errorf(ret.Message)
+	if nodeList == nil {
+		nodeList = &RegionNodeList{}
 	}
 
-	// fmt.Println("area list ", string(body))
-	areaList := &AreaList{}
-	if err := interfaceToStruct(ret.Data, &areaList); err != nil {
-		return nil, err
+	if nodeList.List == nil {
+		nodeList.List = make([]*RegionNode, 0)
 	}
+	return nodeList, nil
+}
 
-	return areaList, nil
+func (w *worker) GetTunnels(projectID string) ([]*Tunnel, error) {
+	return w.GetTunnelsCtx(context.Background(), projectID)
 }
 
-func (w *worker) ListNodesWithRegions(areaID string, region string) ([]string, error) {
-	url := fmt.Sprintf("%s/api/v1/project/region/nodes?area_id=%s&region=%s", w.config.APIServer, areaID, region)
-	// Create a new HTTP GET request
-	req, err := http.NewRequest("GET", url, nil)
+func (w *worker) GetTunnelsCtx(ctx context.Context, projectID string) ([]*Tunnel, error) {
+	path := fmt.Sprintf("/api/v1/project/tunnels?project_id=%s", projectID)
+	data, err := do[struct {
+		Tunnels []*Tunnel `json:"tunnels"`
+	}](ctx, w, "GET", path, nil, true)
 	if err != nil {
 		return nil, err
 	}
+	return data.Tunnels, nil
+}
 
-	// Add custom headers if needed
-	addHeaderToRequest(req, w.token)
+// validToken returns the current token, login again first
+// if the token has expired or is about to expire
+func (w *worker) validToken(ctx context.Context) (string, error) {
+	w.tokenLock.Lock()
+	defer w.tokenLock.Unlock()
 
-	// Send the request
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
+	if time.Until(w.expire) < tokenRefreshMargin {
+		if err := w.login(ctx); err != nil {
+			return "", err
+		}
 	}
-	defer resp.Body.Close()
+	return w.token, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("status code %d, %s", resp.StatusCode, string(buf))
+// refreshToken login again because the server rejected staleToken.
+// If a concurrent caller has already replaced staleToken, its token is reused
+func (w *worker) refreshToken(ctx context.Context, staleToken string) (string, error) {
+	w.tokenLock.Lock()
+	defer w.tokenLock.Unlock()
+
+	if w.token == staleToken {
+		if err := w.login(ctx); err != nil {
+			return "", err
+		}
 	}
+	return w.token, nil
+}
 
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+// do send an authorized request to the api server and decode the data of the result as T,
+// body is encoded as json if not nil. Transient failures are retried by the retry policy,
+// idempotent is false for the requests which must not be repeated once they have reached the server
+func do[T any](ctx context.Context, w *worker, method, path string, body interface{}, idempotent bool) (T, error) {
+	var data T
+
+	var buf []byte
+	if body != nil {
+		var err error
+		if buf, err = json.Marshal(body); err != nil {
+			return data, err
+		}
 	}
 
-	ret := Result{}
-	err = json.Unmarshal(body, &ret)
+	err := w.retryPolicy.retry(ctx, idempotent, func() error {
+		var err error
+		data, err = authRequest[T](ctx, w, method, path, buf)
+		return err
+	})
+	return data, err
+}
+
+// authRequest send the request with the current token,
+// if the token is rejected, refresh it and retry once
+func authRequest[T any](ctx context.Context, w *worker, method, path string, body []byte) (T, error) {
+	token, err := w.validToken(ctx)
 	if err != nil {
-		return nil, err
+		var data T
+		return data, err
 	}
 
-	if ret.Code != 0 {
-		return nil, fmt.Errorf(ret.Message)
+	data, err := doRequest[T](ctx, w, method, path, body, token)
+	if !errors.Is(err, ErrUnauthorized) {
+		return data, err
 	}
 
-	// fmt.Println("node list ", string(body))
-	// areaList := &AreaList{}
-	// if err := interfaceToStruct(ret.Data, &areaList); err != nil {
-	// 	return nil, err
-	// }
+	log.Infof("token rejected, login again: %s", err.Error())
+	if token, err = w.refreshToken(ctx, token); err != nil {
+		return data, err
+	}
 
-	return nil, nil
+	return doRequest[T](ctx, w, method, path, body, token)
 }
 
-func (w *worker) GetTunnels(projectID string) ([]*Tunnel, error) {
-	url := fmt.Sprintf("%s/api/v1/project/tunnels?project_id=%s", w.config.APIServer, projectID)
-	// Create a new HTTP GET request
-	req, err := http.NewRequest("GET", url, nil)
+// doRequest send a single request, token is empty for login
+func doRequest[T any](ctx context.Context, w *worker, method, path string, body []byte, token string) (T, error) {
+	var data T
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	ctx, cancel := w.withTimeout(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, w.config.APIServer+path, reader)
 	if err != nil {
-		return nil, err
+		return data, err
 	}
 
 	// Add custom headers if needed
-	addHeaderToRequest(req, w.token)
+	addHeaderToRequest(req, token)
+	if len(w.userAgent) > 0 {
+		req.Header.Set("User-Agent", w.userAgent)
+	}
 
 	// Send the request
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := w.handler(req)
 	if err != nil {
-		return nil, err
+		return data, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("status code %d, %s", resp.StatusCode, string(buf))
-	}
+	return decodeResult[T](resp)
+}
+
+// result is Result with the data decoded as T
+type result[T any] struct {
+	Code    int    `json:"code"`
+	Data    T      `json:"data"`
+	Message string `json:"message"`
+}
+
+// decodeResult read the response of api server and returns its data,
+// a failed status or non-zero code is returned as *APIError
+func decodeResult[T any](resp *http.Response) (T, error) {
+	var data T
 
-	// Read the response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return data, err
 	}
 
-	ret := Result{}
-	err = json.Unmarshal(body, &ret)
-	if err != nil {
-		return nil, err
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &APIError{Endpoint: resp.Request.URL.Path, StatusCode: resp.StatusCode, Message: string(body)}
+		apiErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		// the body may still be a Result, keep the code and message of it
+		ret := &Result{}
+		if json.Unmarshal(body, ret) == nil && len(ret.Message) > 0 {
+			apiErr.Code = ret.Code
+			apiErr.Message = ret.Message
+		}
+		return data, apiErr
 	}
 
-	if ret.Code != 0 {
-		return nil, fmt.Errorf(ret.Message)
+	// decode the code first, the data of a failed result may not be a T
+	ret := &Result{}
+	if err = json.Unmarshal(body, ret); err != nil {
+		return data, fmt.Errorf("%s decode response failed %w", resp.Request.URL.Path, err)
 	}
 
-	data := struct {
-		Tunnels []*Tunnel `json:"tunnels"`
-	}{}
+	if ret.Code != 0 {
+		return data, &APIError{Endpoint: resp.Request.URL.Path, StatusCode: resp.StatusCode, Code: ret.Code, Message: ret.Message}
+	}
 
-	err = interfaceToStruct(ret.Data, &data)
-	if err != nil {
-		return nil, err
+	typed := &result[T]{}
+	if err = json.Unmarshal(body, typed); err != nil {
+		return data, fmt.Errorf("%s decode response data failed %w", resp.Request.URL.Path, err)
 	}
-	// fmt.Println("tunnel list ", string(body))
-	return data.Tunnels, nil
+	return typed.Data, nil
 }
 
-func (w *worker) login() error {
+// login must be called with tokenLock held, except in NewWorker
+func (w *worker) login(ctx context.Context) error {
 	loginReq := struct {
 		UserName string `json:"username"`
 		Password string `json:"password"`
@@ -528,55 +510,14 @@ func (w *worker) login() error {
 		return err
 	}
 
-	url := fmt.Sprintf("%s/api/v1/user/login", w.config.APIServer)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(buf))
-	if err != nil {
-		return err
-	}
-
-	// Add custom headers if needed
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("cache-control", "no-cache")
-
-	// Send the request
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("status code %d, %s", resp.StatusCode, string(buf))
-	}
-
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-
-	ret := Result{}
-	err = json.Unmarshal(body, &ret)
-	if err != nil {
-		return err
-	}
-
-	if ret.Code != 0 {
-		return fmt.Errorf(ret.Message)
-	}
-
-	loginResult := struct {
+	loginResult, err := doRequest[struct {
 		Token  string `json:"token"`
 		Expire string `json:"expire"`
-	}{}
-
-	if err := interfaceToStruct(ret.Data, &loginResult); err != nil {
+	}](ctx, w, "POST", "/api/v1/user/login", buf, "")
+	if err != nil {
 		return err
 	}
 
-	// fmt.Println("loginResult %#v", loginResult)
-
 	timeFormat := "2006-01-02T15:04:05-07:00"
 	expireTime, err := time.Parse(timeFormat, loginResult.Expire)
 	if err != nil {
@@ -588,75 +529,136 @@ func (w *worker) login() error {
 	return nil
 }
 
-func interfaceToStruct(input interface{}, output interface{}) error {
-	jsonData, err := json.Marshal(input)
-	if err != nil {
-		return fmt.Errorf("error marshaling map to JSON: %w", err)
+// withTimeout bound a single http request to the worker timeout,
+// unless the caller has already set a deadline on ctx
+func (w *worker) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || w.timeout == 0 {
+		return context.WithCancel(ctx)
 	}
-
-	if err := json.Unmarshal(jsonData, output); err != nil {
-		return fmt.Errorf("error unmarshaling JSON to struct: %w", err)
-	}
-
-	return nil
+	return context.WithTimeout(ctx, w.timeout)
 }
 
 func addHeaderToRequest(req *http.Request, token string) {
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("cache-control", "no-cache")
-	req.Header.Add("jwtAuthorization", "Bearer "+token)
+	if len(token) > 0 {
+		req.Header.Add("jwtAuthorization", "Bearer "+token)
+	}
 }
 
 func (w *worker) LoadProjects(page, size int) ([]*PorjectInfo, error) {
-	projects, err := w.GetProjects(page, size)
+	return w.LoadProjectsCtx(context.Background(), page, size)
+}
+
+func (w *worker) LoadProjectsCtx(ctx context.Context, page, size int) ([]*PorjectInfo, error) {
+	projects, err := w.GetProjectsCtx(ctx, page, size)
 	if err != nil {
 		return nil, err
 	}
 
-	projectInfos := make([]*PorjectInfo, 0)
-	for _, project := range projects {
-		projectInfo, err := w.GetProjectInfo(project.ID)
-		if err != nil {
-			fmt.Printf("GetProjectInfo %s %s\n", project.AreaID, err.Error())
-			continue
-		}
-		projectInfos = append(projectInfos, projectInfo)
+	pInfos := make([]*PorjectInfo, 0)
+	err = loadProjectInfos(ctx, w, projects, w.concurrency, func(pInfo *PorjectInfo) error {
+		pInfos = append(pInfos, pInfo)
+		return nil
+	})
+
+	var projectErrs ProjectErrors
+	if err != nil && !errors.As(err, &projectErrs) {
+		return nil, err
 	}
 
-	count := 0
-	serviceStatus := 1
-	pInfos := make([]*PorjectInfo, 0)
+	return pInfos, err
+}
 
-	for _, projectInfo := range projectInfos {
-		nodes := make([]*Node, 0)
-		for _, ap := range projectInfo.Nodes {
-			if ap.Status != serviceStatus {
-				continue
+// loadProjectInfos get the info of projects by at most concurrency requests at a time,
+// and pass the projects which have serving nodes to fn in the order of projects,
+// only with the serving nodes. The failed projects are skipped and returned as ProjectErrors
+func loadProjectInfos(ctx context.Context, w Worker, projects []*Project, concurrency int, fn func(*PorjectInfo) error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	type result struct {
+		info *PorjectInfo
+		err  error
+		done chan struct{}
+	}
+
+	results := make([]*result, 0, len(projects))
+	for range projects {
+		results = append(results, &result{done: make(chan struct{})})
+	}
+
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+
+	// stop the pending requests if fn fails
+	loadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sem := make(chan struct{}, concurrency)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i, project := range projects {
+			select {
+			case sem <- struct{}{}:
+			case <-loadCtx.Done():
+				for _, r := range results[i:] {
+					r.err = loadCtx.Err()
+					close(r.done)
+				}
+				return
 			}
 
-			if len(ap.URL) == 0 {
-				continue
-			}
+			wg.Add(1)
+			go func(r *result, projectID string) {
+				defer wg.Done()
+				r.info, r.err = w.GetProjectInfoCtx(loadCtx, projectID)
+				<-sem
+				close(r.done)
+			}(results[i], project.ID)
+		}
+	}()
 
-			nodes = append(nodes, ap)
-			count++
+	var errs ProjectErrors
+	for i, r := range results {
+		<-r.done
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
 
-		if len(nodes) == 0 {
+		if r.err != nil {
+			errs = append(errs, &ProjectError{ProjectID: projects[i].ID, Err: r.err})
 			continue
 		}
 
-		info := &PorjectInfo{
-			ID:        projectInfo.ID,
-			Name:      projectInfo.Name,
-			BundleURL: projectInfo.BundleURL,
-			AreaID:    projectInfo.AreaID,
-			Replicas:  projectInfo.Replicas,
-			Nodes:     nodes,
+		info := servingProjectInfo(r.info)
+		if info == nil {
+			continue
+		}
+
+		if err := fn(info); err != nil {
+			return err
 		}
-		pInfos = append(pInfos, info)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// servingProjectInfo returns a copy of projectInfo with only the started nodes
+// which have a websocket url, nil if there is no such node
+func servingProjectInfo(projectInfo *PorjectInfo) *PorjectInfo {
+	nodes := projectInfo.ServingNodes()
 
+	if len(nodes) == 0 {
+		return nil
 	}
 
-	return pInfos, nil
+	servingInfo := *projectInfo
+	servingInfo.Nodes = nodes
+	return &servingInfo
 }
@@ -0,0 +1,396 @@
+package worker_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	worker "github.com/zscboy/titan-workers-sdk"
+	"github.com/zscboy/titan-workers-sdk/workertest"
+)
+
+const loginPath = "/api/v1/user/login"
+
+func fastRetry() worker.RetryPolicy {
+	policy := worker.DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	policy.MaxBackoff = 5 * time.Millisecond
+	return policy
+}
+
+func newTestWorker(t *testing.T, s *workertest.Server, opts ...worker.Option) worker.Worker {
+	t.Helper()
+	opts = append([]worker.Option{worker.WithRetryPolicy(fastRetry())}, opts...)
+	w, err := worker.NewWorker(s.Config(), opts...)
+	if err != nil {
+		t.Fatalf("NewWorker %s", err.Error())
+	}
+	return w
+}
+
+func addProject(s *workertest.Server, name string, startedNodes int) string {
+	info := &worker.PorjectInfo{Name: name, AreaID: "Asia-China-Guangdong-Shenzhen", Replicas: startedNodes}
+	for i := 0; i < startedNodes; i++ {
+		info.Nodes = append(info.Nodes, &worker.Node{ID: fmt.Sprintf("e_%s-%d", name, i), URL: "ws://127.0.0.1", Status: worker.NodeStatusStarted})
+	}
+	return s.AddProject(info, "china")
+}
+
+func TestLoginAgainWhenTokenRejected(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	w := newTestWorker(t, s)
+	s.ExpireTokens()
+
+	if _, err := w.GetProjects(0, 10); err != nil {
+		t.Fatalf("GetProjects %s", err.Error())
+	}
+
+	if calls := s.Calls(loginPath); calls != 2 {
+		t.Fatalf("login calls %d, expect 2", calls)
+	}
+}
+
+func TestLoginBeforeTokenExpire(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	// tokens expiring within the refresh margin are replaced before use
+	s.SetTokenTTL(30 * time.Second)
+	w := newTestWorker(t, s)
+
+	if _, err := w.GetProjects(0, 10); err != nil {
+		t.Fatalf("GetProjects %s", err.Error())
+	}
+
+	if calls := s.Calls(loginPath); calls != 2 {
+		t.Fatalf("login calls %d, expect 2", calls)
+	}
+}
+
+func TestConcurrentCallsLoginOnce(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	w := newTestWorker(t, s)
+	s.ExpireTokens()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := w.GetProjects(0, 10); err != nil {
+				t.Errorf("GetProjects %s", err.Error())
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls := s.Calls(loginPath); calls != 2 {
+		t.Fatalf("login calls %d, expect 2", calls)
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	w := newTestWorker(t, s, worker.WithRetryPolicy(worker.NoRetry()))
+
+	_, err := w.GetProjectInfo("not-exist")
+	if !errors.Is(err, worker.ErrNotFound) {
+		t.Fatalf("GetProjectInfo error %v, expect ErrNotFound", err)
+	}
+
+	s.InjectFault("/api/v1/project/list", 1, workertest.Fault{StatusCode: http.StatusTooManyRequests, Message: "slow down"})
+	_, err = w.GetProjects(0, 10)
+	if !errors.Is(err, worker.ErrRateLimited) {
+		t.Fatalf("GetProjects error %v, expect ErrRateLimited", err)
+	}
+
+	var apiErr *worker.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("GetProjects error %v, expect APIError", err)
+	}
+
+	if apiErr.Endpoint != "/api/v1/project/list" || apiErr.StatusCode != http.StatusTooManyRequests || apiErr.Message != "slow down" {
+		t.Fatalf("unexpected APIError %#v", apiErr)
+	}
+
+	s.InjectFault("/api/v1/project/delete", 1, workertest.Fault{Code: 500, Message: "internal"})
+	err = w.DeleteProject("p")
+	if !errors.As(err, &apiErr) || apiErr.Code != 500 || errors.Is(err, worker.ErrUnauthorized) {
+		t.Fatalf("DeleteProject error %v, expect APIError with code 500", err)
+	}
+}
+
+func TestRetryTransientFailures(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	w := newTestWorker(t, s)
+
+	s.InjectFault("/api/v1/project/list", 2, workertest.Fault{StatusCode: http.StatusBadGateway})
+	if _, err := w.GetProjects(0, 10); err != nil {
+		t.Fatalf("GetProjects %s", err.Error())
+	}
+
+	if calls := s.Calls("/api/v1/project/list"); calls != 3 {
+		t.Fatalf("list calls %d, expect 3", calls)
+	}
+
+	s.InjectFault("/api/v1/project/info", 1, workertest.Fault{Drop: true})
+	id := addProject(s, "retry", 1)
+	if _, err := w.GetProjectInfo(id); err != nil {
+		t.Fatalf("GetProjectInfo %s", err.Error())
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	dialErr := func(errno syscall.Errno) error {
+		return &url.Error{Op: "Post", URL: "http://127.0.0.1", Err: &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", errno)}}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"canceled", &url.Error{Op: "Post", URL: "http://127.0.0.1", Err: context.Canceled}, false},
+		{"timeout", &url.Error{Op: "Post", URL: "http://127.0.0.1", Err: context.DeadlineExceeded}, true},
+		{"refused", dialErr(syscall.ECONNREFUSED), true},
+		{"reset", dialErr(syscall.ECONNRESET), true},
+		{"unreachable", dialErr(syscall.ENETUNREACH), false},
+		{"unexpected eof", &url.Error{Op: "Post", URL: "http://127.0.0.1", Err: io.ErrUnexpectedEOF}, true},
+		{"unknown authority", &url.Error{Op: "Post", URL: "https://127.0.0.1", Err: x509.UnknownAuthorityError{}}, false},
+		{"hostname", &url.Error{Op: "Post", URL: "https://127.0.0.1", Err: x509.HostnameError{Host: "127.0.0.1"}}, false},
+		{"tls alert", &url.Error{Op: "Post", URL: "https://127.0.0.1", Err: tls.AlertError(40)}, false},
+		{"unsupported scheme", &url.Error{Op: "Post", URL: "ftp://127.0.0.1", Err: errors.New("unsupported protocol scheme")}, false},
+		{"server error", &worker.APIError{StatusCode: http.StatusBadGateway}, true},
+		{"bad request", &worker.APIError{StatusCode: http.StatusBadRequest}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := worker.IsRetryable(test.err); got != test.want {
+				t.Fatalf("IsRetryable %v, expect %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	w := newTestWorker(t, s)
+
+	s.InjectFault("/api/v1/project/list", 1, workertest.Fault{StatusCode: http.StatusServiceUnavailable, RetryAfter: "1"})
+	start := time.Now()
+	if _, err := w.GetProjects(0, 10); err != nil {
+		t.Fatalf("GetProjects %s", err.Error())
+	}
+
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("retried after %s, expect the 1s of Retry-After", elapsed)
+	}
+}
+
+func TestRetryAfterTooLong(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	w := newTestWorker(t, s)
+
+	s.InjectFault("/api/v1/project/list", 1, workertest.Fault{StatusCode: http.StatusServiceUnavailable, RetryAfter: "3600"})
+	start := time.Now()
+	if _, err := w.GetProjects(0, 10); err == nil {
+		t.Fatalf("GetProjects expect error")
+	}
+
+	if elapsed, calls := time.Since(start), s.Calls("/api/v1/project/list"); elapsed > time.Second || calls != 1 {
+		t.Fatalf("gave up after %s and %d calls, expect at once", elapsed, calls)
+	}
+
+	// MaxRetryAfter 0 is bound by MaxBackoff
+	policy := fastRetry()
+	policy.MaxRetryAfter = 0
+	w = newTestWorker(t, s, worker.WithRetryPolicy(policy))
+	s.InjectFault("/api/v1/project/list", 1, workertest.Fault{StatusCode: http.StatusServiceUnavailable, RetryAfter: "1"})
+	if _, err := w.GetProjects(0, 10); err == nil {
+		t.Fatalf("GetProjects expect error")
+	}
+}
+
+func TestCreateProjectNotRetried(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	w := newTestWorker(t, s)
+
+	s.InjectFault("/api/v1/project/create", 1, workertest.Fault{StatusCode: http.StatusInternalServerError})
+	req := &worker.ReqCreateProject{ProjectBase: worker.ProjectBase{Name: "p", BundleURL: "https://bundle", Replicas: 1}}
+	if err := w.CreateProject(req); err == nil {
+		t.Fatalf("CreateProject expect error")
+	}
+
+	if calls := s.Calls("/api/v1/project/create"); calls != 1 {
+		t.Fatalf("create calls %d, expect 1", calls)
+	}
+}
+
+func TestContextDeadline(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	w := newTestWorker(t, s)
+	s.SetLatency(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := w.GetProjectsCtx(ctx, 0, 10)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetProjectsCtx error %v, expect DeadlineExceeded", err)
+	}
+
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("GetProjectsCtx did not stop at the deadline")
+	}
+}
+
+func TestProjectInfoIterator(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	w := newTestWorker(t, s, worker.WithConcurrency(2))
+
+	expect := make([]string, 0)
+	for i := 0; i < 7; i++ {
+		started := 1
+		// projects without serving nodes are skipped, but must not stop the paging
+		if i%3 == 0 {
+			started = 0
+		}
+
+		id := addProject(s, fmt.Sprintf("p%d", i), started)
+		if started > 0 {
+			expect = append(expect, id)
+		}
+	}
+
+	pInfos, err := worker.NewProjectInfoIterator(w, 3).All(context.Background())
+	if err != nil {
+		t.Fatalf("All %s", err.Error())
+	}
+
+	if len(pInfos) != len(expect) {
+		t.Fatalf("got %d projects, expect %d", len(pInfos), len(expect))
+	}
+
+	for i, pInfo := range pInfos {
+		if pInfo.ID != expect[i] {
+			t.Fatalf("project %d is %s, expect %s", i, pInfo.ID, expect[i])
+		}
+	}
+
+	projects, err := worker.NewProjectIterator(w, 3).All(context.Background())
+	if err != nil || len(projects) != 7 {
+		t.Fatalf("ProjectIterator All returns %d projects, %v", len(projects), err)
+	}
+}
+
+func TestLoadProjectsPartialFailure(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	w := newTestWorker(t, s, worker.WithRetryPolicy(worker.NoRetry()))
+	for i := 0; i < 4; i++ {
+		addProject(s, fmt.Sprintf("p%d", i), 1)
+	}
+
+	s.InjectFault("/api/v1/project/info", 1, workertest.Fault{StatusCode: http.StatusInternalServerError})
+	pInfos, err := w.LoadProjects(0, 10)
+
+	var projectErrs worker.ProjectErrors
+	if !errors.As(err, &projectErrs) || len(projectErrs) != 1 {
+		t.Fatalf("LoadProjects error %v, expect 1 ProjectError", err)
+	}
+
+	if len(pInfos) != 3 {
+		t.Fatalf("LoadProjects returns %d projects, expect 3", len(pInfos))
+	}
+}
+
+func TestListNodesWithRegions(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	w := newTestWorker(t, s)
+	for i := 0; i < 5; i++ {
+		s.AddRegionNodes("Asia-China", "china", &worker.RegionNode{ID: fmt.Sprintf("e_%d", i), IP: "10.0.0.1", Status: worker.NodeStatusStarted, CPUCores: 4})
+	}
+
+	nodeList, err := w.ListNodesWithRegions("Asia-China", "china", 1, 3)
+	if err != nil {
+		t.Fatalf("ListNodesWithRegions %s", err.Error())
+	}
+
+	if nodeList.Total != 5 || len(nodeList.List) != 2 || nodeList.List[0].ID != "e_3" || nodeList.List[0].CPUCores != 4 || nodeList.List[0].Status != worker.NodeStatusStarted {
+		t.Fatalf("unexpected node list %#v", nodeList)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	s := workertest.NewServer()
+	defer s.Close()
+
+	lock := sync.Mutex{}
+	metrics := make([]worker.RequestMetric, 0)
+	observe := func(metric worker.RequestMetric) {
+		lock.Lock()
+		metrics = append(metrics, metric)
+		lock.Unlock()
+	}
+
+	headers := make([]string, 0)
+	recordHeader := func(next worker.Handler) worker.Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			headers = append(headers, req.Header.Get("X-Gateway-Key"))
+			return next(req)
+		}
+	}
+
+	w := newTestWorker(t, s, worker.WithMiddleware(worker.MetricsMiddleware(observe), worker.HeaderMiddleware("X-Gateway-Key", "key"), recordHeader))
+	s.InjectFault("/api/v1/project/list", 1, workertest.Fault{StatusCode: http.StatusServiceUnavailable})
+
+	if _, err := w.GetProjects(0, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	// login, the failed list and the retried list
+	if len(metrics) != 3 || metrics[0].Path != loginPath || metrics[1].StatusCode != http.StatusServiceUnavailable || metrics[2].StatusCode != http.StatusOK {
+		t.Fatalf("metrics %+v", metrics)
+	}
+
+	for _, header := range headers {
+		if header != "key" {
+			t.Fatalf("header %q, want key", header)
+		}
+	}
+}
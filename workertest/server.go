@@ -0,0 +1,560 @@
+// Package workertest provides an in-process fake of the Titan api server,
+// so that Worker, the selectors and the commands can be tested offline.
+package workertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	worker "github.com/zscboy/titan-workers-sdk"
+)
+
+const (
+	DefaultUserName = "admin"
+	DefaultPassword = "admin"
+
+	codeUnauthorized = 401
+	codeNotFound     = 404
+
+	expireFormat = "2006-01-02T15:04:05-07:00"
+)
+
+// Fault make a request fail instead of being served
+type Fault struct {
+	// StatusCode is the http status of the response, 0 means 200.
+	// 200 with a non-zero Code is an api error
+	StatusCode int
+	Code       int
+	Message    string
+	// Drop reset the connection without response
+	Drop bool
+	// RetryAfter is the Retry-After header of the response, e.g. "1"
+	RetryAfter string
+}
+
+// Server is the fake api server, all methods are safe for concurrent use
+type Server struct {
+	// URL is the base url to set as worker.Config.APIServer
+	URL      string
+	UserName string
+	Password string
+
+	srv *httptest.Server
+
+	lock        sync.Mutex
+	tokenTTL    time.Duration
+	tokens      map[string]time.Time
+	tokenSeq    int
+	projects    []*project
+	projectSeq  int
+	areas       []*worker.Area
+	regionNodes map[string][]*worker.RegionNode
+	latency     time.Duration
+	faults      map[string][]Fault
+	calls       map[string]int
+}
+
+type project struct {
+	worker.Project
+	nodes []*worker.Node
+}
+
+// NewServer start a fake server which accepts DefaultUserName and DefaultPassword,
+// call Close to stop it
+func NewServer() *Server {
+	s := &Server{
+		UserName:    DefaultUserName,
+		Password:    DefaultPassword,
+		tokenTTL:    time.Hour,
+		tokens:      make(map[string]time.Time),
+		regionNodes: make(map[string][]*worker.RegionNode),
+		faults:      make(map[string][]Fault),
+		calls:       make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/user/login", s.login)
+	mux.HandleFunc("/api/v1/project/create", s.auth(s.createProject))
+	mux.HandleFunc("/api/v1/project/update", s.auth(s.updateProject))
+	mux.HandleFunc("/api/v1/project/delete", s.auth(s.deleteProject))
+	mux.HandleFunc("/api/v1/project/list", s.auth(s.listProjects))
+	mux.HandleFunc("/api/v1/project/info", s.auth(s.projectInfo))
+	mux.HandleFunc("/api/v1/project/regions", s.auth(s.regions))
+	mux.HandleFunc("/api/v1/project/region/nodes", s.auth(s.listRegionNodes))
+	mux.HandleFunc("/api/v1/project/tunnels", s.auth(s.tunnels))
+
+	s.srv = httptest.NewServer(s.intercept(mux))
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close stop the server
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Config returns a worker config to login to the server
+func (s *Server) Config() *worker.Config {
+	return &worker.Config{UserName: s.UserName, Password: s.Password, APIServer: s.URL}
+}
+
+// SetLatency delay every response by latency
+func (s *Server) SetLatency(latency time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.latency = latency
+}
+
+// InjectFault make the next count requests to path fail with fault,
+// path is like /api/v1/project/list
+func (s *Server) InjectFault(path string, count int, fault Fault) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i := 0; i < count; i++ {
+		s.faults[path] = append(s.faults[path], fault)
+	}
+}
+
+// SetTokenTTL set the lifetime of the tokens issued by the next logins
+func (s *Server) SetTokenTTL(ttl time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.tokenTTL = ttl
+}
+
+// ExpireTokens reject all the issued tokens, as if they have expired
+func (s *Server) ExpireTokens() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.tokens = make(map[string]time.Time)
+}
+
+// Calls returns the count of requests to path, including the failed ones
+func (s *Server) Calls(path string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.calls[path]
+}
+
+// AddProject add a project as if it was deployed, its nodes are copied.
+// It returns the project id, which is generated if info.ID is empty
+func (s *Server) AddProject(info *worker.PorjectInfo, region string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	id := info.ID
+	if len(id) == 0 {
+		id = s.newProjectID()
+	}
+
+	p := &project{
+		Project: worker.Project{
+			ID:          id,
+			Status:      "running",
+			AreaID:      info.AreaID,
+			Region:      region,
+			Expiration:  info.Expiration,
+			Version:     info.Version,
+			CreatedTime: worker.FormatExpiration(time.Now()),
+			ProjectBase: worker.ProjectBase{Name: info.Name, BundleURL: info.BundleURL, Replicas: info.Replicas},
+		},
+	}
+	for _, node := range info.Nodes {
+		n := *node
+		p.nodes = append(p.nodes, &n)
+	}
+	s.projects = append(s.projects, p)
+	return id
+}
+
+// ProjectInfo returns a copy of the project, nil if it does not exist
+func (s *Server) ProjectInfo(projectID string) *worker.PorjectInfo {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	p := s.findProject(projectID)
+	if p == nil {
+		return nil
+	}
+	return p.info()
+}
+
+// SetNodeStatus change the status of a node of the project, a started node
+// get a websocket url. It returns false if the node does not exist
+func (s *Server) SetNodeStatus(projectID, nodeID string, status worker.NodeStatus) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	p := s.findProject(projectID)
+	if p == nil {
+		return false
+	}
+
+	for _, node := range p.nodes {
+		if node.ID == nodeID {
+			s.setNodeStatus(node, status)
+			return true
+		}
+	}
+	return false
+}
+
+// StartNodes mark all nodes of the project started
+func (s *Server) StartNodes(projectID string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	p := s.findProject(projectID)
+	if p == nil {
+		return
+	}
+
+	for _, node := range p.nodes {
+		s.setNodeStatus(node, worker.NodeStatusStarted)
+	}
+}
+
+// AddArea add an area returned by GetRegions
+func (s *Server) AddArea(area *worker.Area) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.areas = append(s.areas, area)
+}
+
+// AddRegionNodes add the nodes returned by ListNodesWithRegions
+func (s *Server) AddRegionNodes(areaID, region string, nodes ...*worker.RegionNode) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	key := areaID + "/" + region
+	s.regionNodes[key] = append(s.regionNodes[key], nodes...)
+}
+
+func (s *Server) newProjectID() string {
+	s.projectSeq++
+	return fmt.Sprintf("project-%d", s.projectSeq)
+}
+
+func (s *Server) findProject(projectID string) *project {
+	for _, p := range s.projects {
+		if p.ID == projectID {
+			return p
+		}
+	}
+	return nil
+}
+
+func (s *Server) setNodeStatus(node *worker.Node, status worker.NodeStatus) {
+	node.Status = status
+	if status == worker.NodeStatusStarted && len(node.URL) == 0 {
+		node.URL = strings.Replace(s.URL, "http", "ws", 1)
+	}
+}
+
+func (p *project) info() *worker.PorjectInfo {
+	info := &worker.PorjectInfo{
+		ID:         p.ID,
+		Name:       p.Name,
+		BundleURL:  p.BundleURL,
+		AreaID:     p.AreaID,
+		Replicas:   p.Replicas,
+		Expiration: p.Expiration,
+		Version:    p.Version,
+		Nodes:      make([]*worker.Node, 0, len(p.nodes)),
+	}
+	for _, node := range p.nodes {
+		n := *node
+		info.Nodes = append(info.Nodes, &n)
+	}
+	return info
+}
+
+// intercept count the requests, and apply the latency and the faults
+func (s *Server) intercept(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		s.calls[r.URL.Path]++
+		latency := s.latency
+		var fault *Fault
+		if faults := s.faults[r.URL.Path]; len(faults) > 0 {
+			fault = &faults[0]
+			s.faults[r.URL.Path] = faults[1:]
+		}
+		s.lock.Unlock()
+
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		if fault == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if fault.Drop {
+			if hijacker, ok := w.(http.Hijacker); ok {
+				if conn, _, err := hijacker.Hijack(); err == nil {
+					// close with a RST instead of a FIN
+					if tcpConn, ok := conn.(*net.TCPConn); ok {
+						tcpConn.SetLinger(0)
+					}
+					conn.Close()
+					return
+				}
+			}
+		}
+
+		statusCode := fault.StatusCode
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+		if len(fault.RetryAfter) > 0 {
+			w.Header().Set("Retry-After", fault.RetryAfter)
+		}
+		writeResult(w, statusCode, fault.Code, fault.Message, nil)
+	})
+}
+
+func (s *Server) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("jwtAuthorization"), "Bearer ")
+
+		s.lock.Lock()
+		expire, ok := s.tokens[token]
+		s.lock.Unlock()
+
+		if !ok || time.Now().After(expire) {
+			writeResult(w, http.StatusUnauthorized, codeUnauthorized, "token is expired", nil)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	req := struct {
+		UserName string `json:"username"`
+		Password string `json:"password"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResult(w, http.StatusBadRequest, 400, err.Error(), nil)
+		return
+	}
+
+	if req.UserName != s.UserName || req.Password != s.Password {
+		writeResult(w, http.StatusUnauthorized, codeUnauthorized, "incorrect Username or Password", nil)
+		return
+	}
+
+	s.lock.Lock()
+	s.tokenSeq++
+	token := fmt.Sprintf("token-%d", s.tokenSeq)
+	expire := time.Now().Add(s.tokenTTL)
+	s.tokens[token] = expire
+	s.lock.Unlock()
+
+	data := map[string]string{"token": token, "expire": expire.Format(expireFormat)}
+	writeResult(w, http.StatusOK, 0, "", data)
+}
+
+func (s *Server) createProject(w http.ResponseWriter, r *http.Request) {
+	req := &worker.ReqCreateProject{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeResult(w, http.StatusBadRequest, 400, err.Error(), nil)
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	p := &project{
+		Project: worker.Project{
+			ID:          s.newProjectID(),
+			Status:      "running",
+			AreaID:      req.AreaID,
+			Region:      req.Region,
+			Expiration:  req.Expiration,
+			Version:     req.Version,
+			CreatedTime: worker.FormatExpiration(time.Now()),
+			ProjectBase: req.ProjectBase,
+		},
+	}
+
+	nodeIDs := make([]string, 0)
+	for _, nodeID := range strings.Split(req.NodeIDs, ",") {
+		if nodeID = strings.TrimSpace(nodeID); len(nodeID) > 0 {
+			nodeIDs = append(nodeIDs, nodeID)
+		}
+	}
+	for i := 0; len(nodeIDs) == 0 && i < req.Replicas; i++ {
+		p.nodes = append(p.nodes, &worker.Node{ID: fmt.Sprintf("e_%s-%d", p.ID, i), AreaID: req.AreaID})
+	}
+	for _, nodeID := range nodeIDs {
+		p.nodes = append(p.nodes, &worker.Node{ID: nodeID, AreaID: req.AreaID})
+	}
+
+	s.projects = append(s.projects, p)
+	writeResult(w, http.StatusOK, 0, "", nil)
+}
+
+func (s *Server) updateProject(w http.ResponseWriter, r *http.Request) {
+	req := &worker.ReqUpdatePorjct{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeResult(w, http.StatusBadRequest, 400, err.Error(), nil)
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	p := s.findProject(req.ID)
+	if p == nil {
+		writeResult(w, http.StatusOK, codeNotFound, "project not found", nil)
+		return
+	}
+
+	if len(req.Name) > 0 {
+		p.Name = req.Name
+	}
+	if len(req.BundleURL) > 0 {
+		p.BundleURL = req.BundleURL
+	}
+	if req.Replicas > 0 {
+		p.Replicas = req.Replicas
+	}
+	if len(req.Expiration) > 0 {
+		p.Expiration = req.Expiration
+	}
+	writeResult(w, http.StatusOK, 0, "", nil)
+}
+
+func (s *Server) deleteProject(w http.ResponseWriter, r *http.Request) {
+	projectID := r.URL.Query().Get("project_id")
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i, p := range s.projects {
+		if p.ID == projectID {
+			s.projects = append(s.projects[:i], s.projects[i+1:]...)
+			writeResult(w, http.StatusOK, 0, "", nil)
+			return
+		}
+	}
+	writeResult(w, http.StatusOK, codeNotFound, "project not found", nil)
+}
+
+func (s *Server) listProjects(w http.ResponseWriter, r *http.Request) {
+	page, size := pageOf(r)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	list := make([]*worker.Project, 0)
+	for _, p := range paginate(len(s.projects), page, size) {
+		project := s.projects[p].Project
+		list = append(list, &project)
+	}
+	writeResult(w, http.StatusOK, 0, "", map[string]interface{}{"list": list, "total": len(s.projects)})
+}
+
+func (s *Server) projectInfo(w http.ResponseWriter, r *http.Request) {
+	projectID := r.URL.Query().Get("project_id")
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	infos := make([]*worker.PorjectInfo, 0)
+	if p := s.findProject(projectID); p != nil {
+		infos = append(infos, p.info())
+	}
+	writeResult(w, http.StatusOK, 0, "", infos)
+}
+
+func (s *Server) regions(w http.ResponseWriter, r *http.Request) {
+	area := strings.ToLower(r.URL.Query().Get("region"))
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	areaList := &worker.AreaList{List: make([]*worker.Area, 0)}
+	for _, a := range s.areas {
+		if strings.HasPrefix(strings.ToLower(a.AreaID), area) {
+			areaList.List = append(areaList.List, a)
+		}
+	}
+	writeResult(w, http.StatusOK, 0, "", areaList)
+}
+
+func (s *Server) listRegionNodes(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	key := query.Get("area_id") + "/" + query.Get("region")
+	page, size := pageOf(r)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	nodes := s.regionNodes[key]
+	list := make([]*worker.RegionNode, 0)
+	for _, i := range paginate(len(nodes), page, size) {
+		list = append(list, nodes[i])
+	}
+	writeResult(w, http.StatusOK, 0, "", &worker.RegionNodeList{Total: len(nodes), List: list})
+}
+
+func (s *Server) tunnels(w http.ResponseWriter, r *http.Request) {
+	projectID := r.URL.Query().Get("project_id")
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	p := s.findProject(projectID)
+	if p == nil {
+		writeResult(w, http.StatusOK, codeNotFound, "project not found", nil)
+		return
+	}
+
+	tunnels := make([]*worker.Tunnel, 0)
+	for i, node := range p.nodes {
+		if node.Status != worker.NodeStatusStarted {
+			continue
+		}
+		url := fmt.Sprintf("%s/project/%s/%s/tun", node.URL, node.ID, p.ID)
+		tunnels = append(tunnels, &worker.Tunnel{ProjectID: p.ID, NodeID: node.ID, Index: i, WSURL: url})
+	}
+	writeResult(w, http.StatusOK, 0, "", map[string]interface{}{"tunnels": tunnels})
+}
+
+func pageOf(r *http.Request) (int, int) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	size, err := strconv.Atoi(r.URL.Query().Get("size"))
+	if err != nil || size <= 0 {
+		size = 20
+	}
+	return page, size
+}
+
+// paginate returns the indexes of the page
+func paginate(total, page, size int) []int {
+	indexes := make([]int, 0)
+	for i := page * size; i < total && i < (page+1)*size; i++ {
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+func writeResult(w http.ResponseWriter, statusCode, code int, message string, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": code, "message": message, "data": data})
+}